@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Backend stores cache entries by key. It must be safe for concurrent use.
+type Backend interface {
+	// Get returns the entry stored under key, if it has not expired.
+	Get(key string) (*Entry, bool)
+	// Set stores e under key, replacing any entry there.
+	Set(key string, e *Entry)
+}
+
+// An Entry is a cached page.
+type Entry struct {
+	Body    []byte
+	Policy  Policy
+	Expires time.Time
+}
+
+// Pages caches rendered pages in a Backend. A page is stored under its route
+// key, usually the request path, together with the values of the query
+// parameters, headers and cookies that its policy varies by. Since those are
+// only known once the page has been rendered, Pages also records the policy
+// of each route key, and looks that up first.
+type Pages struct {
+	Backend Backend
+
+	now func() time.Time // for tests
+}
+
+// NewPages returns a Pages that stores its pages in b.
+func NewPages(b Backend) *Pages {
+	return &Pages{Backend: b, now: time.Now}
+}
+
+// Get returns the cached page for route and r, if there is one.
+func (p *Pages) Get(r *http.Request, route string) (*Entry, bool) {
+	spec, ok := p.Backend.Get("vary\x00" + route)
+	if !ok {
+		return nil, false
+	}
+	return p.Backend.Get(pageKey(r, route, spec.Policy))
+}
+
+// Put caches body, rendered for route and r with the given policy, if the
+// policy allows it.
+func (p *Pages) Put(r *http.Request, route string, policy Policy, body []byte) {
+	if !policy.Cacheable() {
+		return
+	}
+	expires := p.clock()().Add(policy.TTL)
+	p.Backend.Set("vary\x00"+route, &Entry{Policy: policy, Expires: expires})
+	p.Backend.Set(pageKey(r, route, policy), &Entry{Body: body, Policy: policy, Expires: expires})
+}
+
+// SetHeaders sets the headers for e, a page from p, as its policy does, but
+// with the time it has left in the cache as the max-age.
+func (p *Pages) SetHeaders(h http.Header, e *Entry) {
+	e.Policy.setHeaders(h, e.Expires.Sub(p.clock()()))
+}
+
+func (p *Pages) clock() func() time.Time {
+	if p.now != nil {
+		return p.now
+	}
+	return time.Now
+}
+
+// pageKey returns the key of the page for route and r under policy.
+func pageKey(r *http.Request, route string, policy Policy) string {
+	b := new(strings.Builder)
+	b.WriteString("page\x00")
+	b.WriteString(route)
+	q := r.URL.Query()
+	for _, k := range policy.Query {
+		b.WriteString("\x00q:" + url.QueryEscape(k) + "=" + url.QueryEscape(strings.Join(q[k], ",")))
+	}
+	for _, k := range policy.Header {
+		b.WriteString("\x00h:" + k + "=" + strings.Join(r.Header[http.CanonicalHeaderKey(k)], ","))
+	}
+	for _, k := range policy.Cookie {
+		v := ""
+		if c, err := r.Cookie(k); err == nil {
+			v = c.Value
+		}
+		b.WriteString("\x00c:" + url.QueryEscape(k) + "=" + url.QueryEscape(v))
+	}
+	return b.String()
+}
+
+// LRU is an in-memory Backend that holds up to a fixed number of entries,
+// dropping the least recently used when it is full.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[string]*list.Element
+	now     func() time.Time // for tests
+}
+
+type lruItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewLRU returns an LRU that holds up to size entries.
+func NewLRU(size int) *LRU {
+	return &LRU{size: size, ll: list.New(), entries: map[string]*list.Element{}, now: time.Now}
+}
+
+func (c *LRU) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	it := el.Value.(*lruItem)
+	if !c.now().Before(it.entry.Expires) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return it.entry, true
+}
+
+func (c *LRU) Set(key string, e *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*lruItem).entry = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(&lruItem{key, e})
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.entries, el.Value.(*lruItem).key)
+	}
+}
+
+// Len returns the number of entries, including expired ones that have not
+// been dropped yet.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"nml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type cached struct {
+	*nml.NodeStruct
+	policy Policy
+}
+
+func (n *cached) CachePolicy() Policy {
+	return n.policy
+}
+
+func TestPolicyOf(t *testing.T) {
+	policies := map[string]Policy{
+		"x-long":  {TTL: time.Hour, Query: []string{"page"}},
+		"x-short": {TTL: time.Minute, Header: []string{"accept-language"}},
+		"x-user":  {Cookie: []string{"session"}},
+	}
+	lookup := func(node *nml.NodeStruct) nml.Node {
+		if p, ok := policies[node.Data]; ok {
+			return &cached{node, p}
+		}
+		return node
+	}
+	nodes, err := nml.ParseFragmentBody(nil, strings.NewReader(`<x-long><p><x-short></x-short></p></x-long><x-user></x-user>`), lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Policy
+	for _, n := range nodes {
+		p = p.Merge(PolicyOf(n))
+	}
+	want := Policy{TTL: time.Minute, Query: []string{"page"}, Header: []string{"Accept-Language"}, Cookie: []string{"session"}}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	h := http.Header{}
+	p.SetHeaders(h)
+	if h.Get("Cache-Control") != "private, max-age=60" || !reflect.DeepEqual(h["Vary"], []string{"Accept-Language", "Cookie"}) {
+		t.Errorf("got headers %v", h)
+	}
+	h = http.Header{}
+	Policy{TTL: 300 * time.Millisecond}.SetHeaders(h)
+	if got := h.Get("Cache-Control"); got != "public, max-age=1" {
+		t.Errorf("TTL under a second: got Cache-Control %q", got)
+	}
+	p = p.Merge(Policy{Uncacheable: true})
+	if p.Cacheable() {
+		t.Errorf("merged with Uncacheable, still cacheable")
+	}
+}
+
+func TestPages(t *testing.T) {
+	now := time.Now()
+	lru := NewLRU(10)
+	lru.now = func() time.Time { return now }
+	pages := NewPages(lru)
+	pages.now = lru.now
+	req := func(url string) *http.Request {
+		return httptest.NewRequest("GET", url, nil)
+	}
+	policy := Policy{TTL: time.Minute, Query: []string{"page"}}
+	pages.Put(req("/blog?page=1&utm=x"), "/blog", policy, []byte("one"))
+	if e, ok := pages.Get(req("/blog?utm=y&page=1"), "/blog"); !ok || string(e.Body) != "one" {
+		t.Errorf("same page: got %v, %v", e, ok)
+	}
+	if _, ok := pages.Get(req("/blog?page=2"), "/blog"); ok {
+		t.Errorf("other page: got a cached entry")
+	}
+	now = now.Add(45 * time.Second)
+	h := http.Header{}
+	if e, ok := pages.Get(req("/blog?page=1"), "/blog"); ok {
+		pages.SetHeaders(h, e)
+	}
+	if got := h.Get("Cache-Control"); got != "public, max-age=15" {
+		t.Errorf("page cached 45s ago: got Cache-Control %q, want the 15s it has left", got)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := pages.Get(req("/blog?page=1"), "/blog"); ok {
+		t.Errorf("expired page: got a cached entry")
+	}
+	pages.Put(req("/x"), "/x", Policy{}, []byte("x"))
+	if _, ok := pages.Get(req("/x"), "/x"); ok {
+		t.Errorf("page without a TTL was cached")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	e := &Entry{Expires: time.Now().Add(time.Hour)}
+	c.Set("a", e)
+	c.Set("b", e)
+	c.Get("a")
+	c.Set("c", e)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("least recently used entry was kept")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("recently used entry was dropped")
+	}
+	if c.Len() != 2 {
+		t.Errorf("got %d entries, want 2", c.Len())
+	}
+}
@@ -0,0 +1,126 @@
+// Package cache caches rendered pages. Components say how their output may be
+// cached by implementing Cacheable, and the policy of a page is the most
+// restrictive of those of its components.
+package cache
+
+import (
+	"net/http"
+	"nml"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cacheable is implemented by components whose output may be cached, or must
+// not be. Components that do not implement it place no restriction on the
+// page, but a page is only cached if at least one of its components gives it
+// a TTL.
+type Cacheable interface {
+	CachePolicy() Policy
+}
+
+// A Policy says how long a page may be cached and what it depends on.
+type Policy struct {
+	// TTL is how long the page may be cached. Zero means no opinion.
+	TTL time.Duration
+	// Query, Header and Cookie name the query parameters, request headers
+	// and cookies that the page depends on. A cached page is only served
+	// to requests that have the same values for all of them.
+	Query, Header, Cookie []string
+	// Uncacheable means the page must not be cached at all, for example
+	// because it shows the visitor's account.
+	Uncacheable bool
+}
+
+// Merge returns the most restrictive combination of p and q: uncacheable if
+// either is, the shorter of their TTLs, and the union of what they vary by.
+func (p Policy) Merge(q Policy) Policy {
+	m := Policy{
+		TTL:         p.TTL,
+		Query:       union(p.Query, q.Query),
+		Header:      union(canonicalHeaders(p.Header), canonicalHeaders(q.Header)),
+		Cookie:      union(p.Cookie, q.Cookie),
+		Uncacheable: p.Uncacheable || q.Uncacheable,
+	}
+	if q.TTL > 0 && (m.TTL == 0 || q.TTL < m.TTL) {
+		m.TTL = q.TTL
+	}
+	return m
+}
+
+// Cacheable reports whether a page with policy p may be cached.
+func (p Policy) Cacheable() bool {
+	return !p.Uncacheable && p.TTL > 0
+}
+
+// SetHeaders sets the Cache-Control and Vary headers that tell browsers and
+// proxies about p. A page that varies by cookie is private to the visitor.
+func (p Policy) SetHeaders(h http.Header) {
+	p.setHeaders(h, p.TTL)
+}
+
+// setHeaders is SetHeaders for a page that may be cached for ttl more, which
+// is less than p.TTL if the page comes from a cache.
+func (p Policy) setHeaders(h http.Header, ttl time.Duration) {
+	switch {
+	case p.Uncacheable:
+		h.Set("Cache-Control", "no-store")
+		return
+	case p.TTL <= 0:
+		h.Set("Cache-Control", "no-cache")
+		return
+	}
+	scope := "public"
+	if len(p.Cookie) > 0 {
+		scope = "private"
+	}
+	// max-age is in whole seconds, rounded up so that a TTL of under a
+	// second does not become max-age=0.
+	h.Set("Cache-Control", scope+", max-age="+strconv.Itoa(int((ttl+time.Second-1)/time.Second)))
+	vary := canonicalHeaders(p.Header)
+	if len(p.Cookie) > 0 {
+		vary = union(vary, []string{"Cookie"})
+	}
+	for _, v := range vary {
+		h.Add("Vary", v)
+	}
+}
+
+// PolicyOf returns the policy of the tree rooted at n: the merged policies of
+// every node in it that implements Cacheable.
+func PolicyOf(n nml.Node) Policy {
+	var p Policy
+	if c, ok := n.(Cacheable); ok {
+		p = p.Merge(c.CachePolicy())
+	}
+	for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+		p = p.Merge(PolicyOf(c))
+	}
+	return p
+}
+
+// union returns the sorted distinct strings of a and b.
+func union(a, b []string) []string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var u []string
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			u = append(u, s)
+		}
+	}
+	sort.Strings(u)
+	return u
+}
+
+func canonicalHeaders(h []string) []string {
+	c := make([]string, len(h))
+	for i, s := range h {
+		c[i] = http.CanonicalHeaderKey(strings.TrimSpace(s))
+	}
+	return c
+}
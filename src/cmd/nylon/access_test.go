@@ -0,0 +1,26 @@
+package main
+
+import (
+	"common"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	rec := new(common.Recorder)
+	h := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("gone"))
+	}), rec)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x?y=1", nil))
+	e := rec.Entries()
+	if len(e) != 1 {
+		t.Fatalf("got %d log lines, want 1", len(e))
+	}
+	for k, want := range map[string]interface{}{"method": "GET", "url": "/x?y=1", "status": 404, "bytes": 4} {
+		if v, _ := e[0].Value(k); v != want {
+			t.Errorf("got %s=%v, want %v", k, v, want)
+		}
+	}
+}
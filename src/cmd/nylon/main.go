@@ -0,0 +1,77 @@
+// Command nylon serves the site with net/http, for running it outside App
+// Engine:
+//
+//	nylon -addr :8080 -content ./content -dev
+//
+// It serves the same handler as the App Engine app, logs each request to
+// stderr, and on SIGINT or SIGTERM stops accepting connections and waits for
+// the requests in flight before exiting.
+package main
+
+import (
+	"common"
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"root"
+	"syscall"
+	"time"
+)
+
+func main() {
+	var (
+		addr     = flag.String("addr", defaultAddr(), "address to listen on")
+		content  = flag.String("content", os.Getenv("NYLON_CONTENT"), "directory of documents to serve instead of the built-in pages")
+		dev      = flag.Bool("dev", root.Dev, "development mode: reload changed templates")
+		grace    = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for requests in flight when shutting down")
+		noAccess = flag.Bool("no-access-log", false, "do not log requests")
+	)
+	flag.Parse()
+
+	logger := common.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags))
+	root.Dev = *dev
+	if *content != "" {
+		if err := root.UseDir(context.Background(), *content); err != nil {
+			logger.Error("loading content failed", "dir", *content, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var h http.Handler = http.DefaultServeMux
+	if !*noAccess {
+		h = accessLog(h, logger)
+	}
+	srv := &http.Server{Addr: *addr, Handler: h}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		s := <-sig
+		logger.Info("shutting down", "signal", s)
+		ctx, cancel := context.WithTimeout(context.Background(), *grace)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Error("shutdown failed", "err", err)
+		}
+	}()
+
+	logger.Info("listening", "addr", *addr, "dev", root.Dev)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Error("serving failed", "err", err)
+		os.Exit(1)
+	}
+	<-done
+}
+
+// defaultAddr listens on $PORT if it is set, as container platforms expect.
+func defaultAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
@@ -0,0 +1,25 @@
+//go:build appengine
+// +build appengine
+
+package common
+
+import (
+	"appengine"
+	"net/http"
+)
+
+func init() {
+	RequestLogger = func(r *http.Request) Logger {
+		return &AppEngineLogger{appengine.NewContext(r)}
+	}
+}
+
+// AppEngineLogger is a Logger that writes to the request log of App Engine.
+type AppEngineLogger struct {
+	appengine.Context
+}
+
+func (l *AppEngineLogger) Debug(msg string, kv ...interface{}) { l.Debugf("%s", Format(msg, kv...)) }
+func (l *AppEngineLogger) Info(msg string, kv ...interface{})  { l.Infof("%s", Format(msg, kv...)) }
+func (l *AppEngineLogger) Warn(msg string, kv ...interface{})  { l.Warningf("%s", Format(msg, kv...)) }
+func (l *AppEngineLogger) Error(msg string, kv ...interface{}) { l.Errorf("%s", Format(msg, kv...)) }
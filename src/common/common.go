@@ -1,15 +1,132 @@
+// Package common holds what the other packages of the site share: the Logger
+// interface and its adapters.
 package common
 
 import (
+	"fmt"
+	"log"
 	"net/http"
-	"appengine"
+	"os"
+	"strconv"
+	"strings"
 )
 
-type Logger struct {
-	*http.Request
+// A Logger writes structured log lines: a message followed by alternating
+// keys and values, as in
+//
+//	logger.Info("template parsed", "id", id, "nodes", n)
+//
+// Keys are strings. A trailing key without a value is logged with the value
+// "(MISSING)".
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
 }
 
-func (l *Logger) Info(f string, s ...interface{}) {
-	c := appengine.NewContext(l.Request)
-	c.Infof(f, s)
+// Level is the severity of a log line.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "Level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// RequestLogger returns the Logger for the lines logged while serving r. It
+// is set to the App Engine adapter in App Engine builds; otherwise it returns
+// a StdLogger writing to stderr, tagged with the method and path of r.
+var RequestLogger = func(r *http.Request) Logger {
+	return &StdLogger{
+		Logger: log.New(os.Stderr, "", log.LstdFlags),
+		Level:  LevelInfo,
+		Fields: []interface{}{"method", r.Method, "url", r.URL.Path},
+	}
 }
+
+// StdLogger is a Logger that writes to a log.Logger, one line per call:
+//
+//	INFO template parsed id=card nodes=12
+type StdLogger struct {
+	Logger *log.Logger
+	// Level is the lowest level that is written.
+	Level Level
+	// Fields are written after those of each call.
+	Fields []interface{}
+}
+
+// NewStdLogger returns a StdLogger that writes lines of level Info and above
+// to l.
+func NewStdLogger(l *log.Logger) *StdLogger {
+	return &StdLogger{Logger: l, Level: LevelInfo}
+}
+
+func (l *StdLogger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *StdLogger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *StdLogger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *StdLogger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *StdLogger) log(level Level, msg string, kv []interface{}) {
+	if level < l.Level {
+		return
+	}
+	b := new(strings.Builder)
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	writeFields(b, kv)
+	writeFields(b, l.Fields)
+	l.Logger.Output(3, b.String())
+}
+
+// Format formats msg and kv the way StdLogger writes them, without a level.
+// It is meant for adapters to loggers that take a single string.
+func Format(msg string, kv ...interface{}) string {
+	b := new(strings.Builder)
+	b.WriteString(msg)
+	writeFields(b, kv)
+	return b.String()
+}
+
+func writeFields(b *strings.Builder, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(kv[i]))
+		b.WriteByte('=')
+		if i+1 == len(kv) {
+			b.WriteString("(MISSING)")
+			break
+		}
+		s := fmt.Sprint(kv[i+1])
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	}
+}
+
+// Discard is a Logger that drops everything.
+var Discard Logger = discard{}
+
+type discard struct{}
+
+func (discard) Debug(msg string, kv ...interface{}) {}
+func (discard) Info(msg string, kv ...interface{})  {}
+func (discard) Warn(msg string, kv ...interface{})  {}
+func (discard) Error(msg string, kv ...interface{}) {}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	b := new(bytes.Buffer)
+	l := NewStdLogger(log.New(b, "", 0))
+	l.Fields = []interface{}{"req", 7}
+	l.Debug("dropped")
+	l.Info("parsed", "id", "card", "nodes", 12)
+	l.Error("failed", "err", "no such file", "empty", "", "odd")
+	want := "INFO parsed id=card nodes=12 req=7\n" +
+		`ERROR failed err="no such file" empty="" odd=(MISSING) req=7` + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := new(Recorder)
+	r.Warn("slow", "ms", 300)
+	e := r.Entries()
+	if len(e) != 1 || e[0].String() != "WARN slow ms=300" {
+		t.Fatalf("got entries %v", e)
+	}
+	if v, ok := e[0].Value("ms"); !ok || v != 300 {
+		t.Errorf("got ms=%v, %v", v, ok)
+	}
+	r.Reset()
+	if e := r.Entries(); len(e) != 0 {
+		t.Errorf("got %d entries after Reset", len(e))
+	}
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"sync"
+)
+
+// Recorder is a Logger that keeps what it is given, for tests to inspect.
+type Recorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// An Entry is a line logged to a Recorder.
+type Entry struct {
+	Level Level
+	Msg   string
+	KV    []interface{}
+}
+
+// Value returns the value logged with key, and whether there was one.
+func (e Entry) Value(key string) (interface{}, bool) {
+	for i := 0; i+1 < len(e.KV); i += 2 {
+		if e.KV[i] == key {
+			return e.KV[i+1], true
+		}
+	}
+	return nil, false
+}
+
+func (e Entry) String() string {
+	return e.Level.String() + " " + Format(e.Msg, e.KV...)
+}
+
+func (r *Recorder) Debug(msg string, kv ...interface{}) { r.add(LevelDebug, msg, kv) }
+func (r *Recorder) Info(msg string, kv ...interface{})  { r.add(LevelInfo, msg, kv) }
+func (r *Recorder) Warn(msg string, kv ...interface{})  { r.add(LevelWarn, msg, kv) }
+func (r *Recorder) Error(msg string, kv ...interface{}) { r.add(LevelError, msg, kv) }
+
+func (r *Recorder) add(level Level, msg string, kv []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, Entry{level, msg, append([]interface{}(nil), kv...)})
+}
+
+// Entries returns the lines logged so far.
+func (r *Recorder) Entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Entry(nil), r.entries...)
+}
+
+// Reset forgets the lines logged so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
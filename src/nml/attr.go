@@ -0,0 +1,258 @@
+package nml
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Components can bind element attributes to exported fields with an attr
+// struct tag naming the attribute and optional flags:
+//
+//	type MyBio struct {
+//		*nml.NodeStruct
+//		Color string        `attr:"color"`
+//		Size  int           `attr:"size,required"`
+//		Delay time.Duration `attr:"delay,omitempty"`
+//		Tags  []string      `attr:"tags"`
+//	}
+//
+// Fields may be strings, bools, signed and unsigned integers, floats,
+// time.Durations, or slices of those, which are written as comma separated
+// lists. A bool attribute is true when it is present with an empty value, its
+// own name or "true". Attributes are bound before Init runs; a missing
+// attribute leaves the field untouched unless the "required" flag is set, in
+// which case it is an error. Attributes holding {{ }} expressions are bound at
+// render time instead, just before PreRender, from their evaluated value.
+//
+// At render time the fields are written back into the attributes, so changes
+// made by Init or PreRender are reflected in the output. False bools are
+// removed. Other zero values are only written to attributes that are already
+// there, so a field that nothing set does not add an attribute, and with the
+// "omitempty" flag they remove those too. Attributes holding expressions are
+// not written back; they render their value.
+
+// attrBinding is a field of a component struct that is bound to an attribute.
+type attrBinding struct {
+	index     []int
+	name      string
+	key       string
+	required  bool
+	omitempty bool
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func newAttrBinding(f reflect.StructField, tag string) (attrBinding, error) {
+	b := attrBinding{index: f.Index, name: f.Name}
+	parts := strings.Split(tag, ",")
+	b.key = strings.ToLower(strings.TrimSpace(parts[0]))
+	if b.key == "" {
+		return b, fmt.Errorf("attr tag without an attribute name")
+	}
+	for _, flag := range parts[1:] {
+		switch strings.TrimSpace(flag) {
+		case "required":
+			b.required = true
+		case "omitempty":
+			b.omitempty = true
+		default:
+			return b, fmt.Errorf("unknown attr tag flag %q", flag)
+		}
+	}
+	if f.PkgPath != "" {
+		return b, fmt.Errorf("attr tag on unexported field")
+	}
+	t := f.Type
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if !isAttrScalar(t) {
+		return b, fmt.Errorf("cannot bind an attribute to a field of type %s", f.Type)
+	}
+	return b, nil
+}
+
+func isAttrScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// bindAttrs sets the attr-tagged fields of n from its attributes. Attributes
+// that hold {{ }} expressions are skipped unless exprs is set, in which case
+// only they are bound, from the evaluated value.
+func bindAttrs(n Node, exprs bool) error {
+	ct := typeOf(n)
+	if ct == nil {
+		return nil
+	}
+	if ct.err != nil {
+		return ct.err
+	}
+	if len(ct.attrs) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(n).Elem()
+	for _, b := range ct.attrs {
+		s, ok := attrValue(n, b.key)
+		if !ok {
+			if b.required && !exprs {
+				return fmt.Errorf("nml: %s: missing required attribute %s", elementName(n), b.key)
+			}
+			continue
+		}
+		if interpolates(n, s) != exprs {
+			continue
+		}
+		if exprs {
+			var err error
+			if s, err = interpolate(n, s, ""); err != nil {
+				return fmt.Errorf("nml: %s: attribute %s: %v", elementName(n), b.key, err)
+			}
+		}
+		f := v.FieldByIndex(b.index)
+		x, err := parseAttr(f.Type(), b.key, s)
+		if err != nil {
+			return fmt.Errorf("nml: %s: attribute %s=%q: %v", elementName(n), b.key, s, err)
+		}
+		f.Set(x)
+	}
+	return nil
+}
+
+func parseAttr(t reflect.Type, key, s string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if t == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return v, fmt.Errorf("not a valid duration")
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "", key, "true":
+			v.SetBool(true)
+		case "false":
+			v.SetBool(false)
+		default:
+			return v, fmt.Errorf("not a valid bool")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("not a valid %s", t)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(strings.TrimSpace(s), 10, t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("not a valid %s", t)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), t.Bits())
+		if err != nil {
+			return v, fmt.Errorf("not a valid %s", t)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if strings.TrimSpace(s) == "" {
+			return reflect.MakeSlice(t, 0, 0), nil
+		}
+		items := strings.Split(s, ",")
+		v = reflect.MakeSlice(t, 0, len(items))
+		for i, item := range items {
+			x, err := parseAttr(t.Elem(), key, strings.TrimSpace(item))
+			if err != nil {
+				return v, fmt.Errorf("item %d: %v", i, err)
+			}
+			v = reflect.Append(v, x)
+		}
+	default:
+		panic("unreachable")
+	}
+	return v, nil
+}
+
+func formatAttr(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return ""
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatAttr(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	}
+	panic("unreachable")
+}
+
+// reflectAttrs writes the attr-tagged fields of n back into its attributes.
+func reflectAttrs(n Node) {
+	ct := typeOf(n)
+	if ct == nil || ct.err != nil || len(ct.attrs) == 0 {
+		return
+	}
+	v := reflect.ValueOf(n).Elem()
+	attr := make([]Attribute, len(n.GetAttr()), len(n.GetAttr())+len(ct.attrs))
+	copy(attr, n.GetAttr())
+	for _, b := range ct.attrs {
+		s, present := attrValue(n, b.key)
+		if interpolates(n, s) {
+			continue
+		}
+		f := v.FieldByIndex(b.index)
+		remove := f.Kind() == reflect.Bool && !f.Bool() || isZero(f) && (b.omitempty || !present)
+		attr = setAttr(attr, b.key, formatAttr(f), remove)
+	}
+	n.SetAttr(attr)
+}
+
+// setAttr sets the value of the attribute key in attr, or removes it.
+func setAttr(attr []Attribute, key, val string, remove bool) []Attribute {
+	for i, a := range attr {
+		if a.Namespace != "" || a.Key != key {
+			continue
+		}
+		if remove {
+			return append(attr[:i], attr[i+1:]...)
+		}
+		attr[i].Val = val
+		return attr
+	}
+	if remove {
+		return attr
+	}
+	return append(attr, Attribute{Key: key, Val: val})
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.Interface() == reflect.Zero(v.Type()).Interface()
+}
@@ -0,0 +1,112 @@
+package nml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type attrCard struct {
+	*NodeStruct
+	Title  string        `attr:"title"`
+	Width  int           `attr:"width"`
+	Ratio  float64       `attr:"ratio,omitempty"`
+	Hidden bool          `attr:"hidden"`
+	Delay  time.Duration `attr:"delay"`
+	Tags   []string      `attr:"tags"`
+	Sizes  []uint8       `attr:"sizes,omitempty"`
+}
+
+type attrRequired struct {
+	*NodeStruct
+	Src string `attr:"src,required"`
+}
+
+func newAttrRegistry() *Registry {
+	r := NewRegistry(nil)
+	r.Register("attr-card", func(node *NodeStruct) Node {
+		return &attrCard{NodeStruct: node}
+	})
+	r.Register("attr-required", func(node *NodeStruct) Node {
+		return &attrRequired{NodeStruct: node}
+	})
+	return r
+}
+
+func TestBindAttrs(t *testing.T) {
+	r := newAttrRegistry()
+	src := `<attr-card title="Hi" width="12" hidden delay="1.5s" tags="a, b,c" sizes="1,2"></attr-card>`
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(src), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nodes[0].(*attrCard)
+	want := &attrCard{
+		NodeStruct: got.NodeStruct,
+		Title:      "Hi",
+		Width:      12,
+		Hidden:     true,
+		Delay:      1500 * time.Millisecond,
+		Tags:       []string{"a", "b", "c"},
+		Sizes:      []uint8{1, 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestBindAttrsErrors(t *testing.T) {
+	r := newAttrRegistry()
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<attr-card id="C" width="wide"></attr-card>`,
+			`nml: attr-card#C: attribute width="wide": not a valid int`,
+		},
+		{
+			`<attr-card hidden="maybe"></attr-card>`,
+			`nml: attr-card: attribute hidden="maybe": not a valid bool`,
+		},
+		{
+			`<attr-card sizes="1,300"></attr-card>`,
+			`nml: attr-card: attribute sizes="1,300": item 1: not a valid uint8`,
+		},
+		{
+			`<attr-required></attr-required>`,
+			`nml: attr-required: missing required attribute src`,
+		},
+	}
+	for _, tc := range testCases {
+		_, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestReflectAttrs(t *testing.T) {
+	r := newAttrRegistry()
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(`<attr-card hidden ratio="2" width="3" class="x"></attr-card>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := nodes[0].(*attrCard)
+	c.Title = `"quoted"`
+	c.Hidden = false
+	c.Ratio = 0
+	c.Width = 0
+	c.Tags = []string{"x", "y"}
+	b := new(bytes.Buffer)
+	if err := Render(b, c); err != nil {
+		t.Fatal(err)
+	}
+	// Width was in the source, so its zero value is written; Delay was
+	// not, so it adds no attribute.
+	want := `<attr-card width="0" class="x" title="&#34;quoted&#34;" tags="x,y"></attr-card>`
+	if got := b.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
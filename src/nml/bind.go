@@ -0,0 +1,279 @@
+package nml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Components can ask for their descendants to be wired into exported fields
+// with an nml struct tag. The tag holds a selector and optional flags:
+//
+//	type MyTag struct {
+//		*nml.NodeStruct
+//		Me   *MyBio   `nml:"#Me"`
+//		Bios []*MyBio `nml:"my-bio,all"`
+//		Nav  nml.Node `nml:"nav.main,optional"`
+//	}
+//
+// A selector is an optional tag name (or "*") followed by any number of #id
+// and .class qualifiers. Only descendants of the component are searched, in
+// document order. Without flags the first match is assigned and it is an
+// error if nothing matches. The "all" flag assigns every match to a slice
+// field, and the "optional" flag leaves a single field nil when nothing
+// matches. It is an error if a match cannot be assigned to the field.
+//
+// Fields are wired after the children of the component have been parsed and
+// before its Init method runs.
+
+// childBinding is a field of a component struct that is wired to descendants.
+type childBinding struct {
+	index    []int
+	name     string
+	selector string
+	match    func(Node) bool
+	all      bool
+	optional bool
+}
+
+// componentType holds the bindings of a component struct type.
+type componentType struct {
+	children []childBinding
+	attrs    []attrBinding
+	err      error
+}
+
+var componentTypes = struct {
+	sync.Mutex
+	m map[reflect.Type]*componentType
+}{m: map[reflect.Type]*componentType{}}
+
+// typeOf returns the bindings for the dynamic type of n, or nil if n is not a
+// pointer to a struct.
+func typeOf(n Node) *componentType {
+	t := reflect.TypeOf(n)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct || t == nodeStructType {
+		return nil
+	}
+	componentTypes.Lock()
+	defer componentTypes.Unlock()
+	ct, ok := componentTypes.m[t]
+	if !ok {
+		ct = newComponentType(t.Elem())
+		componentTypes.m[t] = ct
+	}
+	return ct
+}
+
+var nodeStructType = reflect.TypeOf(&NodeStruct{})
+
+func newComponentType(t reflect.Type) *componentType {
+	ct := &componentType{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag := f.Tag.Get("nml"); tag != "" {
+			b, err := newChildBinding(f, tag)
+			if err != nil {
+				ct.err = fmt.Errorf("nml: %s.%s: %v", t, f.Name, err)
+				return ct
+			}
+			ct.children = append(ct.children, b)
+		}
+		if tag := f.Tag.Get("attr"); tag != "" {
+			b, err := newAttrBinding(f, tag)
+			if err != nil {
+				ct.err = fmt.Errorf("nml: %s.%s: %v", t, f.Name, err)
+				return ct
+			}
+			ct.attrs = append(ct.attrs, b)
+		}
+	}
+	return ct
+}
+
+func newChildBinding(f reflect.StructField, tag string) (childBinding, error) {
+	b := childBinding{index: f.Index, name: f.Name}
+	parts := strings.Split(tag, ",")
+	b.selector = strings.TrimSpace(parts[0])
+	for _, flag := range parts[1:] {
+		switch strings.TrimSpace(flag) {
+		case "all":
+			b.all = true
+		case "optional":
+			b.optional = true
+		default:
+			return b, fmt.Errorf("unknown nml tag flag %q", flag)
+		}
+	}
+	if f.PkgPath != "" {
+		return b, fmt.Errorf("nml tag on unexported field")
+	}
+	m, err := compileSelector(b.selector)
+	if err != nil {
+		return b, err
+	}
+	b.match = m
+	t := f.Type
+	if b.all {
+		if t.Kind() != reflect.Slice {
+			return b, fmt.Errorf("nml tag %q needs a slice field, not %s", tag, t)
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Interface && t.Kind() != reflect.Ptr {
+		return b, fmt.Errorf("cannot wire elements into a field of type %s", f.Type)
+	}
+	return b, nil
+}
+
+// bindChildren wires the tagged fields of n to its descendants.
+func bindChildren(n Node) error {
+	ct := typeOf(n)
+	if ct == nil {
+		return nil
+	}
+	if ct.err != nil {
+		return ct.err
+	}
+	if len(ct.children) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(n).Elem()
+	for _, b := range ct.children {
+		f := v.FieldByIndex(b.index)
+		matches := findAll(n, b.match, !b.all)
+		if b.all {
+			s := reflect.MakeSlice(f.Type(), 0, len(matches))
+			for _, m := range matches {
+				if err := checkAssignable(n, b, m, f.Type().Elem()); err != nil {
+					return err
+				}
+				s = reflect.Append(s, reflect.ValueOf(m))
+			}
+			f.Set(s)
+			continue
+		}
+		if len(matches) == 0 {
+			if b.optional {
+				f.Set(reflect.Zero(f.Type()))
+				continue
+			}
+			return fmt.Errorf("nml: %s: field %s: %q matched no element", elementName(n), b.name, b.selector)
+		}
+		if err := checkAssignable(n, b, matches[0], f.Type()); err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(matches[0]))
+	}
+	return nil
+}
+
+func checkAssignable(n Node, b childBinding, m Node, t reflect.Type) error {
+	if mt := reflect.TypeOf(m); !mt.AssignableTo(t) {
+		return fmt.Errorf("nml: %s: field %s: %q matched %s (%s), want %s", elementName(n), b.name, b.selector, elementName(m), mt, t)
+	}
+	return nil
+}
+
+// findAll returns the descendants of n for which match returns true, in
+// document order. If first is set, it stops after the first match. The
+// content of inert built-in elements is not searched.
+func findAll(n Node, match func(Node) bool, first bool) []Node {
+	var result []Node
+	var f func(Node) bool
+	f = func(n Node) bool {
+		if isInert(n) {
+			return false
+		}
+		for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+			if match(c) {
+				result = append(result, c)
+				if first {
+					return true
+				}
+			}
+			if f(c) {
+				return true
+			}
+		}
+		return false
+	}
+	f(n)
+	return result
+}
+
+// compileSelector compiles the selectors accepted by nml struct tags: an
+// optional tag name or "*", followed by any number of #id and .class
+// qualifiers.
+func compileSelector(sel string) (func(Node) bool, error) {
+	if sel == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+	var tag, id string
+	var classes []string
+	name, rest := splitSelectorIdent(sel)
+	switch {
+	case name != "":
+		tag = strings.ToLower(name)
+	case strings.HasPrefix(rest, "*"):
+		rest = rest[1:]
+	}
+	for rest != "" {
+		kind := rest[0]
+		var ident string
+		ident, rest = splitSelectorIdent(rest[1:])
+		if ident == "" || (kind != '#' && kind != '.') {
+			return nil, fmt.Errorf("unsupported selector %q", sel)
+		}
+		if kind == '#' {
+			if id != "" {
+				return nil, fmt.Errorf("selector %q has two ids", sel)
+			}
+			id = ident
+		} else {
+			classes = append(classes, ident)
+		}
+	}
+	return func(n Node) bool {
+		if n.GetType() != ElementNode {
+			return false
+		}
+		if tag != "" && n.GetData() != tag {
+			return false
+		}
+		if id != "" {
+			if v, _ := attrValue(n, "id"); v != id {
+				return false
+			}
+		}
+		if len(classes) > 0 {
+			v, _ := attrValue(n, "class")
+			have := strings.Fields(v)
+		classes:
+			for _, c := range classes {
+				for _, h := range have {
+					if h == c {
+						continue classes
+					}
+				}
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// splitSelectorIdent splits the identifier at the start of s from the rest.
+func splitSelectorIdent(s string) (ident, rest string) {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if c == '-' || c == '_' || c >= 0x80 || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+			i++
+			continue
+		}
+		break
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,124 @@
+package nml
+
+import (
+	"strings"
+	"testing"
+)
+
+type bindBio struct {
+	*NodeStruct
+}
+
+type bindPage struct {
+	*NodeStruct
+	Me   *bindBio   `nml:"#Me"`
+	Bios []*bindBio `nml:"bind-bio,all"`
+	Wide Node       `nml:"bind-bio.wide"`
+	Nav  Node       `nml:"nav,optional"`
+}
+
+type bindMissing struct {
+	*NodeStruct
+	Me *bindBio `nml:"#Nobody"`
+}
+
+type bindWrongType struct {
+	*NodeStruct
+	Me *bindBio `nml:"p"`
+}
+
+func newBindRegistry() *Registry {
+	r := NewRegistry(nil)
+	r.Register("bind-bio", func(node *NodeStruct) Node {
+		return &bindBio{NodeStruct: node}
+	})
+	r.Register("bind-page", func(node *NodeStruct) Node {
+		return &bindPage{NodeStruct: node}
+	})
+	r.Register("bind-missing", func(node *NodeStruct) Node {
+		return &bindMissing{NodeStruct: node}
+	})
+	r.Register("bind-wrong-type", func(node *NodeStruct) Node {
+		return &bindWrongType{NodeStruct: node}
+	})
+	return r
+}
+
+func TestBindChildren(t *testing.T) {
+	r := newBindRegistry()
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(`<bind-page><p><bind-bio id="Me"></bind-bio></p><bind-bio class="a wide"></bind-bio></bind-page>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := nodes[0].(*bindPage)
+	if page.Me == nil || page.Me.GetAttr()[0].Val != "Me" {
+		t.Errorf("Me: got %v, want <bind-bio id=Me>", page.Me)
+	}
+	if len(page.Bios) != 2 {
+		t.Errorf("Bios: got %d elements, want 2", len(page.Bios))
+	}
+	if page.Wide != Node(page.Bios[1]) {
+		t.Errorf("Wide: got %v, want the second bio", page.Wide)
+	}
+	if page.Nav != nil {
+		t.Errorf("Nav: got %v, want nil", page.Nav)
+	}
+}
+
+func TestBindChildrenErrors(t *testing.T) {
+	r := newBindRegistry()
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<bind-missing id="M"><bind-bio></bind-bio></bind-missing>`,
+			`nml: bind-missing#M: field Me: "#Nobody" matched no element`,
+		},
+		{
+			`<bind-wrong-type><p></p></bind-wrong-type>`,
+			`nml: bind-wrong-type: field Me: "p" matched p (*nml.NodeStruct), want *nml.bindBio`,
+		},
+	}
+	for _, tc := range testCases {
+		_, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestCompileSelector(t *testing.T) {
+	n := &NodeStruct{
+		Type: ElementNode,
+		Data: "my-bio",
+		Attr: []Attribute{{Key: "id", Val: "Me"}, {Key: "class", Val: "a b"}},
+	}
+	testCases := []struct {
+		sel  string
+		want bool
+	}{
+		{"my-bio", true},
+		{"MY-BIO", true},
+		{"*", true},
+		{"#Me", true},
+		{"#me", false},
+		{"my-bio#Me.b.a", true},
+		{"*.c", false},
+		{"p", false},
+	}
+	for _, tc := range testCases {
+		m, err := compileSelector(tc.sel)
+		if err != nil {
+			t.Errorf("%q: %v", tc.sel, err)
+			continue
+		}
+		if got := m(n); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.sel, got, tc.want)
+		}
+	}
+	for _, sel := range []string{"", "my-bio > p", "a[href]", "#a#b"} {
+		if _, err := compileSelector(sel); err == nil {
+			t.Errorf("%q: want error", sel)
+		}
+	}
+}
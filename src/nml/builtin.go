@@ -0,0 +1,192 @@
+package nml
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// nml has two built-in elements, which the parser creates itself rather than
+// asking lookup for:
+//
+//	<nyl-for each="Items" as="item" index="i">...</nyl-for>
+//	<nyl-if test="!item.Hidden">...</nyl-if>
+//
+// The content of <nyl-for> is repeated for each element of the slice, array
+// or map that each evaluates to (maps are visited in key order). Within each
+// copy, the name given by as holds the element and the name given by index,
+// if any, holds its index or key. The content of <nyl-if> is kept if test
+// evaluates to a true value, and dropped otherwise. See DataContext for how
+// expressions are evaluated.
+//
+// Built-in elements are evaluated in PostInit, so the components that supply
+// their data have completed Init. Until then their content is inert: it is not
+// initialised, and nml struct tags and slots do not see it. Each repetition of
+// <nyl-for> is a fresh copy of the content made with CloneTree, so custom
+// elements inside get their own instances. Built-in elements render only
+// their content, without tags of their own.
+
+// builtin is implemented by the built-in elements.
+type builtin interface {
+	Node
+	// inert reports whether the content has yet to be evaluated.
+	inert() bool
+}
+
+// lookupElement returns the Node for node, creating built-in elements itself
+// and calling lookup for everything else.
+func lookupElement(lookup func(node *NodeStruct) Node, node *NodeStruct) Node {
+	if node.Type == ElementNode && node.Namespace == "" {
+		switch node.Data {
+		case "nyl-for":
+			return &forElement{NodeStruct: node, lookup: lookup}
+		case "nyl-if":
+			return &ifElement{NodeStruct: node}
+		}
+	}
+	return lookup(node)
+}
+
+// isInert reports whether n is a built-in element whose content has yet to be
+// evaluated.
+func isInert(n Node) bool {
+	b, ok := n.(builtin)
+	return ok && b.inert()
+}
+
+// forElement is <nyl-for>.
+type forElement struct {
+	*NodeStruct
+	lookup   func(node *NodeStruct) Node
+	expanded bool
+}
+
+func (n *forElement) inert() bool {
+	return !n.expanded
+}
+
+func (n *forElement) PostInit() error {
+	each, ok := attrValue(n, "each")
+	if !ok {
+		return fmt.Errorf("nml: %s: missing each attribute", Path(n))
+	}
+	as, _ := attrValue(n, "as")
+	index, _ := attrValue(n, "index")
+	v, err := Eval(n, each)
+	if err != nil {
+		return fmt.Errorf("nml: %s: each=%q: %v", Path(n), each, err)
+	}
+	keys, values, err := iterate(v)
+	if err != nil {
+		return fmt.Errorf("nml: %s: each=%q: %v", Path(n), each, err)
+	}
+
+	var body []Node
+	for c := n.GetFirstChild(); c != nil; c = n.GetFirstChild() {
+		RemoveChild(n, c)
+		body = append(body, c)
+	}
+	n.expanded = true
+	for i := range values {
+		vars := map[string]interface{}{}
+		if as != "" {
+			vars[as] = values[i]
+		}
+		if index != "" {
+			vars[index] = keys[i]
+		}
+		it := &itemElement{
+			NodeStruct: &NodeStruct{Type: ElementNode, Data: "nyl-item", Context: n.Context},
+			vars:       vars,
+		}
+		it.setLogger(n.Logger)
+		AppendChild(n, it)
+		for _, b := range body {
+			AppendChild(it, CloneTree(b, n.lookup))
+		}
+		if err := walkPostOrder(it, initNode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterate returns the keys and values of the slice, array or map v.
+func iterate(v interface{}) (keys, values []interface{}, err error) {
+	if v == nil {
+		return nil, nil, nil
+	}
+	x := reflect.ValueOf(v)
+	switch x.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			keys = append(keys, i)
+			values = append(values, x.Index(i).Interface())
+		}
+	case reflect.Map:
+		mk := x.MapKeys()
+		sort.Sort(byString(mk))
+		for _, k := range mk {
+			keys = append(keys, k.Interface())
+			values = append(values, x.MapIndex(k).Interface())
+		}
+	default:
+		return nil, nil, fmt.Errorf("cannot iterate over %T", v)
+	}
+	return keys, values, nil
+}
+
+type byString []reflect.Value
+
+func (s byString) Len() int           { return len(s) }
+func (s byString) Less(i, j int) bool { return fmt.Sprint(s[i].Interface()) < fmt.Sprint(s[j].Interface()) }
+func (s byString) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// itemElement holds one repetition of the content of a <nyl-for>.
+type itemElement struct {
+	*NodeStruct
+	vars map[string]interface{}
+}
+
+func (n *itemElement) inert() bool {
+	return false
+}
+
+func (n *itemElement) variable(name string) (interface{}, bool) {
+	v, ok := n.vars[name]
+	return v, ok
+}
+
+// ifElement is <nyl-if>.
+type ifElement struct {
+	*NodeStruct
+	evaluated bool
+}
+
+func (n *ifElement) inert() bool {
+	return !n.evaluated
+}
+
+func (n *ifElement) PostInit() error {
+	test, ok := attrValue(n, "test")
+	if !ok {
+		return fmt.Errorf("nml: %s: missing test attribute", Path(n))
+	}
+	v, err := Eval(n, test)
+	if err != nil {
+		return fmt.Errorf("nml: %s: test=%q: %v", Path(n), test, err)
+	}
+	n.evaluated = true
+	if !truth(v) {
+		for c := n.GetFirstChild(); c != nil; c = n.GetFirstChild() {
+			RemoveChild(n, c)
+		}
+		return nil
+	}
+	for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+		if err := walkPostOrder(c, initNode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package nml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type builtinList struct {
+	*NodeStruct
+	Items []string
+	Show  bool
+}
+
+func (n *builtinList) Init() error {
+	n.Items = []string{"a", "b", "c"}
+	n.Show = true
+	return nil
+}
+
+type builtinRow struct {
+	*NodeStruct
+	Value interface{}
+}
+
+func (n *builtinRow) PostInit() error {
+	v, err := Eval(n, "item")
+	n.Value = v
+	return err
+}
+
+type builtinData struct {
+	*NodeStruct
+}
+
+func (n *builtinData) DataContext() interface{} {
+	return map[string]interface{}{
+		"Pages": map[string]int{"b": 2, "a": 1},
+	}
+}
+
+func newBuiltinRegistry() *Registry {
+	r := NewRegistry(nil)
+	r.Register("x-list", func(node *NodeStruct) Node {
+		return &builtinList{NodeStruct: node}
+	})
+	r.Register("x-row", func(node *NodeStruct) Node {
+		return &builtinRow{NodeStruct: node}
+	})
+	r.Register("x-data", func(node *NodeStruct) Node {
+		return &builtinData{NodeStruct: node}
+	})
+	return r
+}
+
+func TestBuiltins(t *testing.T) {
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<x-list><nyl-for each="Items" as="item"><i>-</i><nyl-if test='item != "b"'><b>!</b></nyl-if></nyl-for></x-list>`,
+			`<x-list><i>-</i><b>!</b><i>-</i><i>-</i><b>!</b></x-list>`,
+		},
+		{
+			`<x-list><nyl-if test="Show"><p>shown</p></nyl-if><nyl-if test="!Show"><p>hidden</p></nyl-if></x-list>`,
+			`<x-list><p>shown</p></x-list>`,
+		},
+		{
+			`<x-data><nyl-for each="Pages" as="n" index="name"><nyl-if test="name == &quot;b&quot;">b</nyl-if><nyl-if test="n == 1">1</nyl-if></nyl-for></x-data>`,
+			`<x-data>1b</x-data>`,
+		},
+		{
+			`<x-list><nyl-for each="Items" as="item"><nyl-for each="Items" as="item"><nyl-if test='item == "a"'>a</nyl-if></nyl-for></nyl-for></x-list>`,
+			`<x-list>aaa</x-list>`,
+		},
+	}
+	r := newBuiltinRegistry()
+	for _, tc := range testCases {
+		nodes, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		b := new(bytes.Buffer)
+		if err := Render(b, nodes[0]); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestForInstances(t *testing.T) {
+	r := newBuiltinRegistry()
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(`<x-list><nyl-for each="Items" as="item"><x-row></x-row></nyl-for></x-list>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, n := range findAll(nodes[0], func(n Node) bool { _, ok := n.(*builtinRow); return ok }, false) {
+		values = append(values, n.(*builtinRow).Value.(string))
+	}
+	if got := strings.Join(values, ","); got != "a,b,c" {
+		t.Errorf("got rows %s, want a,b,c", got)
+	}
+}
+
+type builtinMeta struct {
+	Author string
+}
+
+type builtinPost struct {
+	*NodeStruct
+	*builtinMeta
+	Info struct {
+		*builtinMeta
+	}
+}
+
+func TestEvalNilEmbedded(t *testing.T) {
+	n := &builtinPost{NodeStruct: &NodeStruct{Type: ElementNode, Data: "x-post"}}
+	text := &NodeStruct{Type: TextNode}
+	AppendChild(n, text)
+	for _, expr := range []string{"Author", "Info.Author"} {
+		if _, err := Eval(text, expr); err == nil {
+			t.Errorf("%s through a nil pointer: got no error", expr)
+		}
+	}
+	n.builtinMeta = &builtinMeta{Author: "me"}
+	n.Info.builtinMeta = n.builtinMeta
+	for _, expr := range []string{"Author", "Info.Author"} {
+		if v, err := Eval(text, expr); err != nil || v != "me" {
+			t.Errorf("%s: got %v, %v, want me", expr, v, err)
+		}
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<x-list><nyl-for each="Nothing" as="item"></nyl-for></x-list>`,
+			`nml: x-list>nyl-for: each="Nothing": unknown name "Nothing"`,
+		},
+		{
+			`<x-list><nyl-for each="Show"></nyl-for></x-list>`,
+			`nml: x-list>nyl-for: each="Show": cannot iterate over bool`,
+		},
+		{
+			`<x-list><nyl-if test="Items.Length"></nyl-if></x-list>`,
+			`nml: x-list>nyl-if: test="Items.Length": Items has no "Length"`,
+		},
+		{
+			`<x-list><nyl-if test="Show =="></nyl-if></x-list>`,
+			`nml: x-list>nyl-if: test="Show ==": bad expression "Show ==": missing operand`,
+		},
+		{
+			`<x-list><nyl-if test="Data"></nyl-if></x-list>`,
+			`nml: x-list>nyl-if: test="Data": unknown name "Data"`,
+		},
+	}
+	r := newBuiltinRegistry()
+	for _, tc := range testCases {
+		_, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package nml
+
+import (
+	"strings"
+)
+
+// A Category tells the parser how to treat a custom element, one whose name
+// is not a standard HTML tag. Without one, a custom element is parsed like a
+// <span>: it cannot hold block content inside a <p>, it is moved out of a
+// <table>, and so on. Categories can be combined with |, but an element is
+// only one of Block, Formatting, Void and RawText: the first of them in that
+// order that it has.
+type Category uint8
+
+const (
+	// Block elements are special, like <div> and <object>: they bound the
+	// scope of the elements open outside them, so a <div> inside one does
+	// not close a <p> outside it, an end tag inside one does not close
+	// elements outside it, and formatting elements such as <b> do not
+	// leak into it.
+	Block Category = 1 << iota
+	// Formatting elements are like <b>: when they are misnested they are
+	// reopened and split up by the adoption agency algorithm, rather than
+	// cut short.
+	Formatting
+	// Void elements are like <br>: they have no content and no end tag in
+	// the source. They are still rendered with an end tag, since a browser
+	// only knows the standard void elements.
+	Void
+	// RawText elements are like <script>: their content is text that is
+	// not parsed or escaped, up to their end tag.
+	RawText
+	// TableContext elements may appear inside a <table>, <tbody>, <thead>,
+	// <tfoot> or <tr>, where they stay, instead of being moved to before
+	// the table. Table content inside them is parsed as though they were
+	// not there.
+	TableContext
+	// SelfClosing elements may be written with the XML-style "/>", as in
+	// <my-bio id="Me"/>, which closes them there and then, rather than
+	// being ignored as it is on other elements. Written with a start tag,
+	// they take content and an end tag as usual. They are always rendered
+	// with an end tag, since a browser would ignore the "/>".
+	SelfClosing
+)
+
+// Categorized is implemented by components whose elements have a Category.
+// The parser asks the component its lookup function returns for a new
+// element of the name, so Category must not depend on anything but the type.
+type Categorized interface {
+	Category() Category
+}
+
+func (c Category) String() string {
+	var names []string
+	for i, name := range []string{"Block", "Formatting", "Void", "RawText", "TableContext", "SelfClosing"} {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "Phrasing"
+	}
+	return strings.Join(names, "|")
+}
+
+// isCustom reports whether n is a custom element: an HTML element with no
+// atom.
+func isCustom(n Node) bool {
+	return n.GetType() == ElementNode && n.GetNamespace() == "" && n.GetDataAtom() == 0
+}
+
+// categoryOf returns the Category of n, or zero if n is not a custom element
+// or does not implement Categorized.
+func categoryOf(n Node) Category {
+	if c, ok := n.(Categorized); ok && isCustom(n) {
+		return c.Category()
+	}
+	return 0
+}
+
+// category returns the Category of custom elements named name, asking the
+// node that p.classify returns for one. The answers are cached for the rest
+// of the parse.
+func (p *parser) category(name string) Category {
+	c, ok := p.categories[name]
+	if !ok {
+		n := p.classify(&NodeStruct{Type: ElementNode, Data: name})
+		c = categoryOf(n)
+		if p.categories == nil {
+			p.categories = map[string]Category{}
+		}
+		p.categories[name] = c
+	}
+	return c
+}
+
+// is reports whether n is a custom element with any of the categories in c.
+func (p *parser) is(n Node, c Category) bool {
+	return isCustom(n) && p.category(n.GetData())&c != 0
+}
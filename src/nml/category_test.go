@@ -0,0 +1,165 @@
+package nml
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+type categorized struct {
+	*NodeStruct
+	category Category
+}
+
+func (n *categorized) Category() Category {
+	return n.category
+}
+
+func newCategoryRegistry() *Registry {
+	r := NewRegistry(nil)
+	for name, c := range map[string]Category{
+		"x-panel":  Block,
+		"x-em":     Formatting,
+		"x-icon":   Void,
+		"x-code":   RawText,
+		"x-row":    TableContext,
+		"x-plain":  0,
+		"x-avatar": SelfClosing,
+		"x-note":   Block | SelfClosing,
+	} {
+		c := c
+		r.Register(name, func(node *NodeStruct) Node {
+			return &categorized{NodeStruct: node, category: c}
+		})
+	}
+	return r
+}
+
+func TestCategories(t *testing.T) {
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<p>intro<x-panel><div>body</div></x-panel>after</p>`,
+			`<p>intro<x-panel><div>body</div></x-panel>after</p>`,
+		},
+		{
+			`<p>intro<x-plain><div>body</div></x-plain>after</p>`,
+			`<p>intro<x-plain></x-plain></p><div>body</div>after<p></p>`,
+		},
+		{
+			`<ul><li>a<x-panel><li>b</li></x-panel></li></ul>`,
+			`<ul><li>a<x-panel><li>b</li></x-panel></li></ul>`,
+		},
+		{
+			`<x-em>a<p>b</x-em>c</p>`,
+			`<x-em>a</x-em><p><x-em>b</x-em>c</p>`,
+		},
+		{
+			`<x-plain>a<p>b</x-plain>c</p>`,
+			`<x-plain>a<p>bc</p></x-plain>`,
+		},
+		{
+			`<p><x-icon name="a">text</p>`,
+			`<p><x-icon name="a"></x-icon>text</p>`,
+		},
+		{
+			`<x-code><b>&amp;</b></x-code>`,
+			`<x-code><b>&amp;</b></x-code>`,
+		},
+		{
+			`<table><x-row><tr><td>1</td></tr></x-row></table>`,
+			`<table><x-row><tbody><tr><td>1</td></tr></tbody></x-row></table>`,
+		},
+		{
+			`<table><tbody><tr><x-row><td>1</td></x-row></tr></tbody></table>`,
+			`<table><tbody><tr><x-row><td>1</td></x-row></tr></tbody></table>`,
+		},
+		{
+			`<table><x-plain><tr><td>1</td></tr></x-plain></table>`,
+			`<x-plain></x-plain><table><tbody><tr><td>1</td></tr></tbody></table>`,
+		},
+		{
+			`<p><x-avatar id="a"/>text</p>`,
+			`<p><x-avatar id="a"></x-avatar>text</p>`,
+		},
+		{
+			`<x-avatar>inner</x-avatar><x-avatar></x-avatar>`,
+			`<x-avatar>inner</x-avatar><x-avatar></x-avatar>`,
+		},
+		{
+			`<b>1<x-note/>2</b><x-note/><div>x</div>`,
+			`<b>1<x-note></x-note>2</b><x-note></x-note><div>x</div>`,
+		},
+		{
+			`<x-plain/>after`,
+			`<x-plain>after</x-plain>`,
+		},
+	}
+	r := newCategoryRegistry()
+	for _, tc := range testCases {
+		nodes, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		b := new(bytes.Buffer)
+		for _, n := range nodes {
+			if err := Render(b, n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestSelfClosingErrors(t *testing.T) {
+	var errs []ParseError
+	src := `<x-avatar/><x-plain/>`
+	if _, err := ParseFragmentBody(nil, strings.NewReader(src), newCategoryRegistry().Lookup, CollectErrors(&errs)); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || errs[0].Code != "self-closing-non-void" || errs[0].Column != 12 {
+		t.Errorf("got %v, want one self-closing-non-void error for <x-plain/> and one eof-in-element", errs)
+	}
+	if _, err := ParseFragmentBody(nil, strings.NewReader(`<x-avatar/>`), newCategoryRegistry().Lookup, Strict()); err != nil {
+		t.Errorf("strict: %v", err)
+	}
+}
+
+func TestTemplateCategories(t *testing.T) {
+	r := newCategoryRegistry()
+	r.Templates = func(id string) (io.Reader, error) {
+		return strings.NewReader(`<p><x-panel><div>x</div></x-panel></p>`), nil
+	}
+	r.Register("x-badge", func(node *NodeStruct) Node {
+		return &templatedBadge{NodeStruct: node}
+	})
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(`<x-badge></x-badge>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	if err := Render(b, nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), `<x-badge><p><x-panel><div>x</div></x-panel></p></x-badge>`; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestCategoryString(t *testing.T) {
+	for c, want := range map[Category]string{
+		0:                    "Phrasing",
+		Void:                 "Void",
+		Block | TableContext: "Block|TableContext",
+		Block | SelfClosing:  "Block|SelfClosing",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
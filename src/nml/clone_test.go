@@ -0,0 +1,70 @@
+package nml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type cloneItem struct {
+	*NodeStruct
+	Price int
+	seen  bool
+}
+
+func (n *cloneItem) CloneFields(dst Node) {
+	dst.(*cloneItem).Price = n.Price
+}
+
+func TestCloneTree(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Register("x-item", func(node *NodeStruct) Node {
+		return &cloneItem{NodeStruct: node}
+	})
+	src := `<ul class="a"><li><x-item id="i">one</x-item></li><svg><title>t</title></svg><!-- c --></ul>`
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(src), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := nodes[0]
+	item := orig.GetFirstChild().GetFirstChild().(*cloneItem)
+	item.Price = 3
+	item.seen = true
+
+	c := CloneTree(orig, r.Lookup)
+	if err := checkTreeConsistency(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetParent() != nil || c.GetNextSibling() != nil {
+		t.Errorf("clone is attached")
+	}
+	b0, b1 := new(bytes.Buffer), new(bytes.Buffer)
+	if err := Render(b0, orig); err != nil {
+		t.Fatal(err)
+	}
+	if err := Render(b1, c); err != nil {
+		t.Fatal(err)
+	}
+	if b0.String() != b1.String() {
+		t.Errorf("got  %s\nwant %s", b1, b0)
+	}
+
+	citem, ok := c.GetFirstChild().GetFirstChild().(*cloneItem)
+	if !ok {
+		t.Fatalf("got %T, want *cloneItem", c.GetFirstChild().GetFirstChild())
+	}
+	if citem == item || citem.Price != 3 || citem.seen {
+		t.Errorf("got %+v, want a new item with Price copied by CloneFields", citem)
+	}
+	if citem.base().phase != phaseParsed {
+		t.Errorf("clone is already initialised")
+	}
+	title := c.GetFirstChild().GetNextSibling().GetFirstChild()
+	if title.GetNamespace() != "svg" {
+		t.Errorf("<title>: got namespace %q, want svg", title.GetNamespace())
+	}
+	c.GetAttr()[0].Val = "b"
+	if orig.GetAttr()[0].Val != "a" {
+		t.Errorf("clone shares attributes with the original")
+	}
+}
@@ -88,13 +88,3 @@ var isSpecialElementMap = map[string]bool{
 	"wbr":        true,
 	"xmp":        true,
 }
-
-func isSpecialElement(element Node) bool {
-	switch element.GetNamespace() {
-	case "", "html":
-		return isSpecialElementMap[element.GetData()]
-	case "svg":
-		return element.GetData() == "foreignObject"
-	}
-	return false
-}
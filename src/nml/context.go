@@ -0,0 +1,76 @@
+package nml
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// A Context carries the request that a tree is parsed and rendered for. Parse
+// and ParseFragment set it on every node they create, including those the
+// parser creates on its own, those copied from templates and <nyl-for>
+// content, and those moved by foster parenting, so components reach it as
+// n.Context from Init, PostInit, PreRender and PostRender.
+//
+// A Context wraps a context.Context. When that is cancelled, for example
+// because the client went away, parsing, initialisation and rendering stop at
+// the next node with an error that wraps the context's error, and components
+// doing slow work of their own should watch n.Context.Done().
+type Context struct {
+	context.Context
+
+	// Request is the request being served, or nil outside a request.
+	Request *http.Request
+
+	// Templates, if not nil, opens the templates of the components in the
+	// tree instead of the Templates function of their Registry, for
+	// example to show an editor the drafts of templates. Templates opened
+	// with it are parsed for each component and not cached.
+	Templates func(id string) (io.Reader, error)
+}
+
+// NewContext returns a Context for the request r, wrapping r's context.
+func NewContext(r *http.Request) *Context {
+	return &Context{Context: r.Context(), Request: r}
+}
+
+// Background returns a Context with no request that is never cancelled.
+func Background() *Context {
+	return &Context{Context: context.Background()}
+}
+
+// orBackground returns ctx, or Background if ctx is nil or has no
+// context.Context, so that the nodes of a tree always have a usable Context.
+func orBackground(ctx *Context) *Context {
+	if ctx == nil {
+		return Background()
+	}
+	if ctx.Context == nil {
+		return &Context{Context: context.Background(), Request: ctx.Request}
+	}
+	return ctx
+}
+
+// checkContext returns an error if the Context of n has been cancelled.
+func checkContext(n Node) error {
+	ctx := n.GetContext()
+	if ctx == nil || ctx.Context == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("nml: %s: %w", Path(n), err)
+	}
+	return nil
+}
+
+// inherit sets the Context and Logger of n and all its descendants, including
+// the inert content of built-in elements, to those of from.
+func inherit(n Node, from *NodeStruct) {
+	b := n.base()
+	b.Context = from.Context
+	b.setLogger(from.Logger)
+	for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+		inherit(c, from)
+	}
+}
@@ -0,0 +1,85 @@
+package nml
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type contextRecorder struct {
+	*NodeStruct
+	seen *Context
+}
+
+func (n *contextRecorder) Init() error {
+	n.seen = n.Context
+	return nil
+}
+
+func (n *contextRecorder) Template() string {
+	return "rec"
+}
+
+func TestContextOnEveryNode(t *testing.T) {
+	r := newBuiltinRegistry()
+	r.Templates = func(id string) (io.Reader, error) {
+		return strings.NewReader(`<i>template</i>`), nil
+	}
+	r.Register("x-rec", func(node *NodeStruct) Node {
+		return &contextRecorder{NodeStruct: node}
+	})
+	// The table foster-parents the text and <x-rec>, and the misnested <b>
+	// makes the adoption agency algorithm clone it.
+	src := `<!DOCTYPE html><table>text<x-rec></x-rec><tr><td>cell</td></tr></table>` +
+		`<x-list><nyl-for each="Items" as="item"><x-rec></x-rec>{{ item }}</nyl-for></x-list>` +
+		`<p><b>bold<p>again</b><!-- comment -->`
+	ctx := &Context{Context: context.Background()}
+	doc, err := Parse(ctx, strings.NewReader(src), r.Lookup, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	var check func(n Node)
+	check = func(n Node) {
+		if n.GetContext() != ctx {
+			t.Errorf("%s has Context %p, want %p", Path(n), n.GetContext(), ctx)
+		}
+		if rec, ok := n.(*contextRecorder); ok {
+			count++
+			if rec.seen != ctx {
+				t.Errorf("%s: Init saw Context %p, want %p", Path(n), rec.seen, ctx)
+			}
+		}
+		for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+			check(c)
+		}
+	}
+	check(doc)
+	if count != 4 {
+		t.Errorf("found %d x-rec elements, want 4", count)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	r := newBuiltinRegistry()
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Parse(&Context{Context: c}, strings.NewReader(`<p>hello</p>`), r.Lookup, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Parse: got error %v, want context.Canceled", err)
+	}
+
+	c, cancel = context.WithCancel(context.Background())
+	nodes, err := ParseFragmentBody(&Context{Context: c}, strings.NewReader(`<x-list><p>hello</p></x-list>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err = Render(new(bytes.Buffer), nodes[0])
+	if !errors.Is(err, context.Canceled) || err.Error() != "nml: x-list: context canceled" {
+		t.Errorf("Render: got error %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,296 @@
+package nml
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Built-in elements and components evaluate expressions against the data
+// context of a node. A name in an expression is resolved by walking up from
+// the node through its ancestors. At each ancestor, in order:
+//
+//   - the variables of a <nyl-for> iteration, e.g. "item" for as="item";
+//   - the value returned by DataContext, if the ancestor implements it;
+//   - otherwise the exported fields of the component, other than those of
+//     the embedded NodeStruct.
+//
+// The first ancestor that has the name wins.
+//
+// An expression is a path, such as "Items" or "item.Author.Name", optionally
+// compared to another path or a literal with == or !=, and optionally negated
+// with a leading !. Literals are double-quoted strings, numbers, true and
+// false. Path elements after the first select struct fields, map entries with
+// string keys, or slice elements by index. Two values are equal if they print
+// the same with fmt.Sprint.
+
+// DataContext is implemented by components that supply their descendants
+// with data other than their own fields. The returned value is a struct, a
+// pointer to a struct or a map with string keys.
+type DataContext interface {
+	DataContext() interface{}
+}
+
+// scoped is implemented by nodes that define variables for their
+// descendants, like the iterations of <nyl-for>.
+type scoped interface {
+	variable(name string) (interface{}, bool)
+}
+
+// Eval evaluates expr against the data context of n.
+func Eval(n Node, expr string) (interface{}, error) {
+	e, err := parseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.eval(n)
+}
+
+// resolve returns the value of name in the data context of n.
+func resolve(n Node, name string) (interface{}, error) {
+	for a := n.GetParent(); a != nil; a = a.GetParent() {
+		if s, ok := a.(scoped); ok {
+			if v, ok := s.variable(name); ok {
+				return v, nil
+			}
+			continue
+		}
+		if d, ok := a.(DataContext); ok {
+			if v, ok := member(reflect.ValueOf(d.DataContext()), name); ok {
+				return v.Interface(), nil
+			}
+			continue
+		}
+		if v, ok := componentField(a, name); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown name %q", name)
+}
+
+// componentField returns the exported field called name of the component n.
+// Fields of the embedded NodeStruct are not considered.
+func componentField(n Node, name string) (interface{}, bool) {
+	v := reflect.ValueOf(n)
+	if v.Type() == nodeStructType || v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	v = v.Elem()
+	f, ok := v.Type().FieldByName(name)
+	if !ok || f.PkgPath != "" || v.Type().Field(f.Index[0]).Type == nodeStructType {
+		return nil, false
+	}
+	x, ok := fieldByIndex(v, f.Index)
+	if !ok {
+		return nil, false
+	}
+	return x.Interface(), true
+}
+
+// member returns the field, map entry or slice element of v called name.
+func member(v reflect.Value, name string) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		f, ok := v.Type().FieldByName(name)
+		if !ok || f.PkgPath != "" {
+			return v, false
+		}
+		return fieldByIndex(v, f.Index)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+		x := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		return x, x.IsValid()
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= v.Len() {
+			return v, false
+		}
+		return v.Index(i), true
+	}
+	return v, false
+}
+
+// fieldByIndex is v.FieldByIndex, but it reports false rather than panicking
+// when the field is promoted through an embedded pointer that is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// truth reports whether v is true in a test: it is not nil, false, zero or
+// empty.
+func truth(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	x := reflect.ValueOf(v)
+	switch x.Kind() {
+	case reflect.Bool:
+		return x.Bool()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array, reflect.Chan:
+		return x.Len() > 0
+	case reflect.Ptr, reflect.Interface, reflect.Func:
+		return !x.IsNil()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return x.Float() != 0
+	}
+	return true
+}
+
+// An expr is a parsed expression.
+type expr struct {
+	not         bool
+	left, right operand
+	op          string
+}
+
+// An operand is a path or a literal.
+type operand struct {
+	path []string
+	lit  interface{}
+}
+
+func parseExpr(s string) (*expr, error) {
+	e := &expr{}
+	rest := strings.TrimSpace(s)
+	if strings.HasPrefix(rest, "!") && !strings.HasPrefix(rest, "!=") {
+		e.not = true
+		rest = rest[1:]
+	}
+	var err error
+	if e.left, rest, err = parseOperand(rest); err != nil {
+		return nil, fmt.Errorf("bad expression %q: %v", s, err)
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return e, nil
+	}
+	if !strings.HasPrefix(rest, "==") && !strings.HasPrefix(rest, "!=") {
+		return nil, fmt.Errorf("bad expression %q: unexpected %q", s, rest)
+	}
+	e.op, rest = rest[:2], rest[2:]
+	if e.right, rest, err = parseOperand(rest); err != nil {
+		return nil, fmt.Errorf("bad expression %q: %v", s, err)
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("bad expression %q: unexpected %q", s, strings.TrimSpace(rest))
+	}
+	return e, nil
+}
+
+func parseOperand(s string) (operand, string, error) {
+	s = strings.TrimLeft(s, " \t\r\n\f")
+	if s == "" {
+		return operand{}, s, fmt.Errorf("missing operand")
+	}
+	if s[0] == '"' {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				lit, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return operand{}, s, err
+				}
+				return operand{lit: lit}, s[i+1:], nil
+			}
+		}
+		return operand{}, s, fmt.Errorf("unterminated string")
+	}
+	i := strings.IndexAny(s, " \t\r\n\f=!")
+	if i < 0 {
+		i = len(s)
+	}
+	word, rest := s[:i], s[i:]
+	switch word {
+	case "":
+		return operand{}, s, fmt.Errorf("unexpected %q", s)
+	case "true":
+		return operand{lit: true}, rest, nil
+	case "false":
+		return operand{lit: false}, rest, nil
+	}
+	if c := word[0]; c == '-' || '0' <= c && c <= '9' {
+		f, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return operand{}, s, fmt.Errorf("bad number %q", word)
+		}
+		return operand{lit: f}, rest, nil
+	}
+	path := strings.Split(word, ".")
+	for _, p := range path {
+		if p == "" {
+			return operand{}, s, fmt.Errorf("bad path %q", word)
+		}
+	}
+	return operand{path: path}, rest, nil
+}
+
+func (e *expr) eval(n Node) (interface{}, error) {
+	l, err := e.left.eval(n)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{} = l
+	if e.op != "" {
+		r, err := e.right.eval(n)
+		if err != nil {
+			return nil, err
+		}
+		eq := fmt.Sprint(l) == fmt.Sprint(r)
+		v = eq == (e.op == "==")
+	}
+	if e.not {
+		v = !truth(v)
+	}
+	return v, nil
+}
+
+func (o operand) eval(n Node) (interface{}, error) {
+	if o.path == nil {
+		if f, ok := o.lit.(float64); ok && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+		return o.lit, nil
+	}
+	v, err := resolve(n, o.path[0])
+	if err != nil {
+		return nil, err
+	}
+	x := reflect.ValueOf(v)
+	for i, name := range o.path[1:] {
+		if !x.IsValid() {
+			return nil, fmt.Errorf("%s is nil", strings.Join(o.path[:i+1], "."))
+		}
+		var ok bool
+		if x, ok = member(x, name); !ok {
+			return nil, fmt.Errorf("%s has no %q", strings.Join(o.path[:i+1], "."), name)
+		}
+	}
+	if !x.IsValid() {
+		return nil, nil
+	}
+	return x.Interface(), nil
+}
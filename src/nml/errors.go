@@ -0,0 +1,79 @@
+package nml
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotFound is returned by a component's Init, or wrapped in the error it
+// returns, when the page it is on should not exist, for example because the
+// blog post named in the URL has no document. The server responds with its
+// not found page instead of rendering the tree. Test for it with errors.Is.
+var ErrNotFound = errors.New("nml: not found")
+
+// A RedirectError is returned by a component's Init to send the client to
+// another URL instead of rendering the tree.
+type RedirectError struct {
+	URL string
+	// Code is the HTTP status of the redirect, such as
+	// http.StatusMovedPermanently.
+	Code int
+}
+
+// Redirect returns a *RedirectError to url with the given status code, or
+// http.StatusFound if code is zero.
+func Redirect(url string, code int) error {
+	if code == 0 {
+		code = http.StatusFound
+	}
+	return &RedirectError{URL: url, Code: code}
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("nml: redirect %d to %s", e.Code, e.URL)
+}
+
+// A ParseError is a place where the input breaks the HTML5 parsing rules.
+// The parser recovers from every such error as the specification says,
+// building the tree a browser would, so ParseErrors are only reported when
+// they are asked for with CollectErrors, or in strict mode, where the first
+// one is returned by the parse.
+//
+// Code names the kind of error:
+//
+//	unexpected-doctype       a doctype anywhere but at the start
+//	unexpected-start-tag     a start tag that is ignored where it appears
+//	unexpected-end-tag       an end tag with no matching open element
+//	unexpected-text          text that is ignored where it appears
+//	misnested-tag            an end tag that closes other elements first
+//	misnested-formatting     a formatting element, such as <b>, closed
+//	                         across a block, which the adoption agency
+//	                         algorithm has to split up
+//	foster-parented          content in a table outside of any cell, which
+//	                         is moved to before the table
+//	self-closing-non-void    "/>" on an element that is not void
+//	eof-in-element           an element still open at the end of the input
+//
+// Strict mode adds two more, for places that are not errors otherwise:
+//
+//	implied-element          an element the parser adds, such as <tbody>
+//	implied-end-tag          an element closed by something other than its
+//	                         end tag
+type ParseError struct {
+	Code    string
+	Message string
+	// Source is the ID of the document, as given to the parser with
+	// SourceID.
+	Source string
+	// Line and Column are where the token that caused the error starts.
+	// Both count from 1.
+	Line, Column int
+}
+
+func (e *ParseError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("nml: %s:%d:%d: %s", e.Source, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("nml: %d:%d: %s", e.Line, e.Column, e.Message)
+}
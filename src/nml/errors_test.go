@@ -0,0 +1,107 @@
+package nml
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCollectErrors(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want []string
+	}{
+		{
+			`<p>ok</p>`,
+			nil,
+		},
+		{
+			"<div>\n  <b>one<p>two</b>three</p>\n</div>",
+			[]string{"2:15 misnested-formatting: </b> closes <b> across <p>"},
+		},
+		{
+			`<div><span></div></span>`,
+			[]string{
+				"1:12 misnested-tag: </div> closes <span> too",
+				"1:18 unexpected-end-tag: unexpected </span>",
+			},
+		},
+		{
+			`<table><tr><td>1</td></tr>oops<i>x</i></table>`,
+			[]string{
+				`1:27 foster-parented: text "oops" moved out of <table>`,
+				"1:31 foster-parented: <i> moved out of <table>",
+			},
+		},
+		{
+			`<div/><!DOCTYPE html></p><section>`,
+			[]string{
+				"1:1 self-closing-non-void: <div/> is not a void element, so the / is ignored",
+				"1:7 unexpected-doctype: unexpected doctype",
+				"1:22 unexpected-end-tag: unexpected </p>",
+				"1:35 eof-in-element: <div> is not closed",
+				"1:35 eof-in-element: <section> is not closed",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		var errs []ParseError
+		if _, err := ParseFragmentBody(nil, strings.NewReader(tc.src), newBuiltinRegistry().Lookup, CollectErrors(&errs)); err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		var got []string
+		for _, e := range errs {
+			got = append(got, fmt.Sprintf("%d:%d %s: %s", e.Line, e.Column, e.Code, e.Message))
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrorString(t *testing.T) {
+	e := &ParseError{Code: "unexpected-end-tag", Message: "unexpected </p>", Line: 3, Column: 7}
+	if got, want := e.Error(), "nml: 3:7: unexpected </p>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	testCases := []struct {
+		src, want string
+	}{
+		{`<div><p>ok</p><br><img src="x"></div>`, ""},
+		{`<table><tr><td>x</td></tr></table>`, "nml: t:1:8: <tbody> is implied but not in the source"},
+		{`<table><tbody><tr><td>1</td></tr></tbody>oops</table>`, `nml: t:1:42: text "oops" moved out of <table>`},
+		{`<p>one<div>two</div></p>`, "nml: t:1:7: <p> is closed by <div> before its end tag"},
+		{`<ul><li>a</ul>`, "nml: t:1:10: <li> is closed by </ul> before its end tag"},
+		{`<b>1<p>2</b>3</p>`, "nml: t:1:9: </b> closes <b> across <p>"},
+		{"<div>\nopen", "nml: t:2:5: <div> is not closed"},
+	}
+	r := newBuiltinRegistry()
+	for _, tc := range testCases {
+		_, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup, Strict(), SourceID("t"))
+		if tc.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.src, err)
+			}
+			continue
+		}
+		if _, ok := err.(*ParseError); !ok || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %s", tc.src, err, tc.want)
+		}
+		if _, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup); err != nil {
+			t.Errorf("%s: lenient: %v", tc.src, err)
+		}
+	}
+
+	doc := `<!DOCTYPE html><html><head><title>t</title></head><body><p>x</p></body></html>`
+	if _, err := Parse(nil, strings.NewReader(doc), r.Lookup, nil, Strict()); err != nil {
+		t.Errorf("%s: %v", doc, err)
+	}
+	_, err := Parse(nil, strings.NewReader(`<p>x</p>`), r.Lookup, nil, Strict())
+	if want := "nml: 1:1: <html> is implied but not in the source"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,284 @@
+package nml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Text and attribute values may contain {{ expr }} interpolations, which are
+// replaced by the value of expr when the tree is rendered. The expression is
+// evaluated against the data context of the text or element, as described at
+// DataContext, so in a component's template it sees the exported fields of
+// the component. A nil value renders as nothing, and anything else as
+// fmt.Sprint prints it.
+//
+// A literal {{ can be written as the expression {{"{{"}}. Markup that is full
+// of them, such as a client-side template, can be left alone by putting the
+// nyl-raw attribute on an element: nothing in it or in its attributes is
+// interpolated, and the attribute itself is not rendered.
+//
+// The result is escaped for where it appears. In text and most attribute
+// values it is escaped like any other text. In a <script>, a value inside a
+// string literal is escaped as string content, and anywhere else it is
+// written as a JSON value, so the string "b" becomes "b" with its quotes. In a
+// <style>, a value inside a string is escaped as string content, and anywhere
+// else it must be a plain value such as red, 10px or #fff. Interpolations in
+// script and style comments are errors. In the other raw text elements, such
+// as <xmp>, nothing is escaped, so a value that could end the element is an
+// error.
+//
+// Attributes follow the same rules where they hold code: event handlers such
+// as onclick are treated as a <script>, and style as a <style>. In attributes
+// that hold a URL, such as href and src, a value that decides the scheme of
+// the URL must leave it http, https, mailto or none, so that a value such as
+// javascript:alert(1) is an error.
+
+// rawAttr is the attribute that turns off interpolation.
+const rawAttr = "nyl-raw"
+
+// hasExpr reports whether s contains an interpolation.
+func hasExpr(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// interpolates reports whether s, the text or an attribute value of n, is
+// interpolated: whether it contains an interpolation and neither n nor an
+// ancestor has the nyl-raw attribute.
+func interpolates(n Node, s string) bool {
+	if !hasExpr(s) {
+		return false
+	}
+	for ; n != nil; n = n.GetParent() {
+		if _, ok := attrValue(n, rawAttr); ok && n.GetType() == ElementNode {
+			return false
+		}
+	}
+	return true
+}
+
+// urlAttrs are the attributes whose values are URLs.
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"codebase":   true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"usemap":     true,
+}
+
+// attrContext returns the context to interpolate the value of the attribute
+// key in: "script" for event handlers, "style" for style, "url" for URLs and
+// "" for anything else.
+func attrContext(key string) string {
+	key = strings.ToLower(key)
+	switch {
+	case strings.HasPrefix(key, "on"):
+		return "script"
+	case key == "style":
+		return "style"
+	case urlAttrs[key]:
+		return "url"
+	}
+	return ""
+}
+
+// interpolate returns s with each interpolation replaced by its value,
+// evaluated against the data context of n. context says where s is: "" for
+// text, the name of a raw text element for its content, or what attrContext
+// returns for an attribute value.
+func interpolate(n Node, s, context string) (string, error) {
+	if !interpolates(n, s) {
+		return s, nil
+	}
+	// first is where the first value starts in the result, for checking
+	// whether values decide the scheme of a URL.
+	first := -1
+	b := new(bytes.Buffer)
+	// static is the text of s outside the interpolations so far, for
+	// finding out where in a script or style sheet each one is.
+	static := new(bytes.Buffer)
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			b.WriteString(s)
+			if context == "url" && first >= 0 {
+				if err := checkURL(b.String(), first); err != nil {
+					return "", err
+				}
+			}
+			return b.String(), nil
+		}
+		j := strings.Index(s[i+2:], "}}")
+		if j < 0 {
+			return "", fmt.Errorf("unterminated {{ in %q", s)
+		}
+		expr := s[i+2 : i+2+j]
+		v, err := Eval(n, expr)
+		if err != nil {
+			return "", fmt.Errorf("{{%s}}: %v", expr, err)
+		}
+		static.WriteString(s[:i])
+		val, err := escapeRaw(v, context, static.String())
+		if err != nil {
+			return "", fmt.Errorf("{{%s}}: %v", expr, err)
+		}
+		b.WriteString(s[:i])
+		if first < 0 {
+			first = b.Len()
+		}
+		b.WriteString(val)
+		s = s[i+2+j+2:]
+	}
+}
+
+// checkURL returns an error if the scheme of the URL u is decided by a value,
+// one starting at first, and is not http, https or mailto.
+func checkURL(u string, first int) error {
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' || first > i {
+		return nil
+	}
+	switch strings.ToLower(u[:i]) {
+	case "http", "https", "mailto":
+		return nil
+	}
+	return fmt.Errorf("unsafe URL %q", u)
+}
+
+// escapeRaw returns v as it is written in context, as interpolate has it,
+// after the text before. In text and plain attributes, it returns v as text,
+// which the renderer escapes.
+func escapeRaw(v interface{}, context, before string) (string, error) {
+	val := ""
+	if v != nil {
+		val = fmt.Sprint(v)
+	}
+	switch context {
+	case "", "url":
+		return val, nil
+	case "script":
+		switch scanRaw(before, "\"'`", true) {
+		case inString:
+			return jsString(val), nil
+		case inComment:
+			return "", fmt.Errorf("interpolation in a script comment")
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		// json.Marshal escapes <, > and &, but not these, which end a
+		// line in older JavaScript.
+		s := strings.Replace(string(b), "\u2028", `\u2028`, -1)
+		return strings.Replace(s, "\u2029", `\u2029`, -1), nil
+	case "style":
+		switch scanRaw(before, "\"'", false) {
+		case inString:
+			return cssString(val), nil
+		case inComment:
+			return "", fmt.Errorf("interpolation in a style comment")
+		}
+		for _, c := range val {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("#%.,_- ", c)) {
+				return "", fmt.Errorf("unsafe value %q in a style sheet", val)
+			}
+		}
+		return val, nil
+	}
+	if strings.Contains(strings.ToLower(val), "</"+context) {
+		return "", fmt.Errorf("value would end the <%s> element", context)
+	}
+	return val, nil
+}
+
+// A rawState is where a point in a script or style sheet is.
+type rawState int
+
+const (
+	inCode rawState = iota
+	inString
+	inComment
+)
+
+// scanRaw returns where the end of the script or style sheet s is. quotes are
+// the characters that delimit strings; /* */ comments are recognized, and //
+// comments too if lineComments is set.
+func scanRaw(s, quotes string, lineComments bool) rawState {
+	state, end := inCode, ""
+	for i := 0; i < len(s); i++ {
+		switch state {
+		case inCode:
+			switch {
+			case strings.IndexByte(quotes, s[i]) >= 0:
+				state, end = inString, s[i:i+1]
+			case strings.HasPrefix(s[i:], "/*"):
+				state, end = inComment, "*/"
+				i++
+			case lineComments && strings.HasPrefix(s[i:], "//"):
+				state, end = inComment, "\n"
+				i++
+			}
+		case inString:
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == end[0] {
+				state = inCode
+			}
+		case inComment:
+			if strings.HasPrefix(s[i:], end) {
+				state = inCode
+				i += len(end) - 1
+			}
+		}
+	}
+	return state
+}
+
+// jsString escapes s as the content of a JavaScript string literal delimited
+// by any quote, including a template literal.
+func jsString(s string) string {
+	b := new(bytes.Buffer)
+	for _, c := range s {
+		switch {
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < ' ' || strings.ContainsRune("\"'`<>&$", c):
+			fmt.Fprintf(b, `\x%02x`, c)
+		case c == '\u2028' || c == '\u2029':
+			fmt.Fprintf(b, `\u%04x`, c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// cssString escapes s as the content of a CSS string, writing everything but
+// letters and digits as a hexadecimal escape.
+func cssString(s string) string {
+	b := new(bytes.Buffer)
+	for _, c := range s {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c >= utf8.RuneSelf {
+			b.WriteRune(c)
+			continue
+		}
+		// The space ends the escape, so that a following hex digit is
+		// not taken as part of it.
+		fmt.Fprintf(b, `\%x `, c)
+	}
+	return b.String()
+}
@@ -0,0 +1,204 @@
+package nml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type interpolateSwatch struct {
+	*NodeStruct
+	Color  string `attr:"color"`
+	Close  string
+	Tricky string
+	seen   string
+}
+
+func (n *interpolateSwatch) PreRender() error {
+	n.seen = n.Color
+	return nil
+}
+
+func newInterpolateRegistry() *Registry {
+	r := newBuiltinRegistry()
+	r.Register("x-swatch", func(node *NodeStruct) Node {
+		return &interpolateSwatch{NodeStruct: node, Close: "</XMP>", Tricky: "\"' \\\n</script>"}
+	})
+	return r
+}
+
+func TestInterpolate(t *testing.T) {
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<x-list><p>{{ Items.0 }} and {{Items.2}}</p></x-list>`,
+			`<x-list><p>a and c</p></x-list>`,
+		},
+		{
+			`<x-list><nyl-for each="Items" as="item" index="i"><a href="/{{ item }}" title="{{i}}">{{ item }}&lt;</a></nyl-for></x-list>`,
+			`<x-list><a href="/a" title="0">a&lt;</a><a href="/b" title="1">b&lt;</a><a href="/c" title="2">c&lt;</a></x-list>`,
+		},
+		{
+			`<x-list><p title="{{ Show }}">{{ Show == false }}</p></x-list>`,
+			`<x-list><p title="true">false</p></x-list>`,
+		},
+		{
+			`<x-list><p>{{"{{"}} Show }}</p></x-list>`,
+			`<x-list><p>{{ Show }}</p></x-list>`,
+		},
+		{
+			`<x-list><script>var x = "{{ Items.1 }}";</script></x-list>`,
+			`<x-list><script>var x = "b";</script></x-list>`,
+		},
+		{
+			`<x-list><script>var x = {{ Items }}, y = {{ Show }};</script></x-list>`,
+			`<x-list><script>var x = ["a","b","c"], y = true;</script></x-list>`,
+		},
+		{
+			`<x-swatch color="red"><script>var s = '{{ Tricky }}';</script></x-swatch>`,
+			`<x-swatch color="red"><script>var s = '\x22\x27 \\\n\x3c/script\x3e';</script></x-swatch>`,
+		},
+		{
+			`<x-swatch color="red"><script>var s = {{ Tricky }};</script></x-swatch>`,
+			`<x-swatch color="red"><script>var s = "\"' \\\n\u003c/script\u003e";</script></x-swatch>`,
+		},
+		{
+			`<x-swatch color="red"><script>var s = "it's \"" + {{ Color }};</script></x-swatch>`,
+			`<x-swatch color="red"><script>var s = "it's \"" + "red";</script></x-swatch>`,
+		},
+		{
+			`<x-swatch color="#fff"><style>p { color: {{ Color }} }</style></x-swatch>`,
+			`<x-swatch color="#fff"><style>p { color: #fff }</style></x-swatch>`,
+		},
+		{
+			`<x-swatch color="red"><style>p::after { content: "{{ Tricky }}" }</style></x-swatch>`,
+			`<x-swatch color="red"><style>p::after { content: "\22 \27 \20 \5c \a \3c \2f script\3e " }</style></x-swatch>`,
+		},
+		{
+			`<x-swatch color="alert(1)"><p onclick="go('{{ Tricky }}', {{ Color }})">x</p></x-swatch>`,
+			`<x-swatch color="alert(1)"><p onclick="go(&#39;\x22\x27 \\\n\x3c/script\x3e&#39;, &#34;alert(1)&#34;)">x</p></x-swatch>`,
+		},
+		{
+			`<x-swatch color="#fff"><p style="color: {{ Color }}" title="{{ Color }};">x</p></x-swatch>`,
+			`<x-swatch color="#fff"><p style="color: #fff" title="#fff;">x</p></x-swatch>`,
+		},
+		{
+			`<x-swatch color="https://example.com/a?b=c"><a href="{{ Color }}">x</a><a href="/go/{{ Color }}">y</a></x-swatch>`,
+			`<x-swatch color="https://example.com/a?b=c"><a href="https://example.com/a?b=c">x</a><a href="/go/https://example.com/a?b=c">y</a></x-swatch>`,
+		},
+		{
+			`<x-swatch color="Mailto:me@example.com"><a href="{{ Color }}">x</a></x-swatch>`,
+			`<x-swatch color="Mailto:me@example.com"><a href="Mailto:me@example.com">x</a></x-swatch>`,
+		},
+		{
+			`<x-list><div nyl-raw title="{{ a }}">{{ b }}<p>{{ c }}</p><script>if (a) {{}}</script></div></x-list>`,
+			`<x-list><div title="{{ a }}">{{ b }}<p>{{ c }}</p><script>if (a) {{}}</script></div></x-list>`,
+		},
+		{
+			`<x-list><nyl-for each="Items" as="item"><x-swatch color="{{ item }}"></x-swatch></nyl-for></x-list>`,
+			`<x-list><x-swatch color="a"></x-swatch><x-swatch color="b"></x-swatch><x-swatch color="c"></x-swatch></x-list>`,
+		},
+	}
+	r := newInterpolateRegistry()
+	for _, tc := range testCases {
+		nodes, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		b := new(bytes.Buffer)
+		if err := Render(b, nodes[0]); err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestInterpolateAttrBinding(t *testing.T) {
+	r := newInterpolateRegistry()
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(`<x-list><x-swatch color="{{ Items.1 }}"></x-swatch></x-list>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Render(new(bytes.Buffer), nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	s := nodes[0].GetFirstChild().(*interpolateSwatch)
+	if s.seen != "b" {
+		t.Errorf("PreRender saw Color %q, want %q", s.seen, "b")
+	}
+	if v, _ := attrValue(s, "color"); v != "{{ Items.1 }}" {
+		t.Errorf("got attribute %q, want the expression to be kept", v)
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	testCases := []struct {
+		src, want string
+	}{
+		{
+			`<x-list><p>{{ Nothing }}</p></x-list>`,
+			`nml: x-list>p>#text: {{ Nothing }}: unknown name "Nothing"`,
+		},
+		{
+			`<x-list><p title="{{ Items.9 }}"></p></x-list>`,
+			`nml: x-list>p: attribute title: {{ Items.9 }}: Items has no "9"`,
+		},
+		{
+			`<x-list><p>{{ Items</p></x-list>`,
+			`nml: x-list>p>#text: unterminated {{ in "{{ Items"`,
+		},
+		{
+			`<x-swatch><xmp>{{ Close }}</xmp></x-swatch>`,
+			`nml: x-swatch>xmp>#text: {{ Close }}: value would end the <xmp> element`,
+		},
+		{
+			`<x-swatch><script>// {{ Close }}</script></x-swatch>`,
+			`nml: x-swatch>script>#text: {{ Close }}: interpolation in a script comment`,
+		},
+		{
+			`<x-swatch><style>/* {{ Color }} */</style></x-swatch>`,
+			`nml: x-swatch>style>#text: {{ Color }}: interpolation in a style comment`,
+		},
+		{
+			`<x-swatch color="javascript:alert(1)"><a href="{{ Color }}">x</a></x-swatch>`,
+			`nml: x-swatch>a: attribute href: unsafe URL "javascript:alert(1)"`,
+		},
+		{
+			`<x-swatch color="script:alert(1)"><img src="java{{ Color }}"></x-swatch>`,
+			`nml: x-swatch>img: attribute src: unsafe URL "javascript:alert(1)"`,
+		},
+		{
+			`<x-swatch color=" data:text/html,x"><form action="{{ Color }}"></form></x-swatch>`,
+			`nml: x-swatch>form: attribute action: unsafe URL " data:text/html,x"`,
+		},
+		{
+			`<x-swatch color="red;background:url(//evil)"><p style="color:{{ Color }}"></p></x-swatch>`,
+			`nml: x-swatch>p: attribute style: {{ Color }}: unsafe value "red;background:url(//evil)" in a style sheet`,
+		},
+		{
+			`<x-swatch><p onclick="go() // {{ Color }}"></p></x-swatch>`,
+			`nml: x-swatch>p: attribute onclick: {{ Color }}: interpolation in a script comment`,
+		},
+		{
+			`<x-swatch><style>p { color: {{ Tricky }} }</style></x-swatch>`,
+			`nml: x-swatch>style>#text: {{ Tricky }}: unsafe value "\"' \\\n</script>" in a style sheet`,
+		},
+	}
+	r := newInterpolateRegistry()
+	for _, tc := range testCases {
+		nodes, err := ParseFragmentBody(nil, strings.NewReader(tc.src), r.Lookup)
+		if err != nil {
+			t.Errorf("%s: %v", tc.src, err)
+			continue
+		}
+		err = Render(new(bytes.Buffer), nodes[0])
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
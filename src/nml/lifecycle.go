@@ -0,0 +1,170 @@
+package nml
+
+// Nodes take part in the component lifecycle by implementing any of the
+// optional interfaces below. Parse and ParseFragment drive the init phases
+// over the whole tree before returning it, and Render drives the render
+// phases. The order is:
+//
+//  1. Bind and Init, children before parent. When a node's Init runs, its
+//     template has been instantiated (see Templated), its attr and nml
+//     struct tags have been bound and every descendant has completed Init.
+//  2. PostInit, parent before children, once Init has run on every node in
+//     the tree. A parent can therefore configure its children before their
+//     PostInit runs.
+//  3. PreRender, parent before children, immediately before the node is
+//     rendered.
+//  4. PostRender, children before parent, once the node and all its
+//     descendants have been rendered.
+//
+// Each init phase runs at most once per node, so subtrees created during Init
+// (e.g. by ParseFragment) are not initialised twice when the walk reaches
+// them.
+
+// Initializer is implemented by nodes that set themselves up once their
+// children are ready.
+type Initializer interface {
+	Init() error
+}
+
+// PostInitializer is implemented by nodes that need to run once the whole
+// tree has been initialised.
+type PostInitializer interface {
+	PostInit() error
+}
+
+// PreRenderer is implemented by nodes that update themselves before they are
+// rendered. Returning an error aborts the render.
+type PreRenderer interface {
+	PreRender() error
+}
+
+// PostRenderer is implemented by nodes that need to run after they have been
+// rendered. Returning an error aborts the render.
+type PostRenderer interface {
+	PostRender() error
+}
+
+// A ComponentError records an error returned by a lifecycle method of a node,
+// together with the path of the node in its tree and where it was parsed from.
+// Parse, ParseFragment and Render return one whenever Init, PostInit,
+// PreRender or PostRender fails.
+type ComponentError struct {
+	Method string
+	Path   string
+	Span   Span
+	Err    error
+}
+
+func (e *ComponentError) Error() string {
+	s := "nml: " + e.Method + " " + e.Path
+	if !e.Span.IsZero() {
+		s += " at " + e.Span.String()
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by the lifecycle method.
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// A phase records how far through the init phases a node has got.
+type phase uint8
+
+const (
+	phaseParsed phase = iota
+	phaseInit
+	phasePostInit
+)
+
+// initTree runs the init phases on the tree rooted at n.
+func initTree(n Node) error {
+	if err := walkPostOrder(n, initNode); err != nil {
+		return err
+	}
+	return walkPreOrder(n, postInitNode)
+}
+
+func initNode(n Node) error {
+	if n.base().phase >= phaseInit {
+		return nil
+	}
+	if err := checkContext(n); err != nil {
+		return err
+	}
+	if t, ok := n.(Templated); ok {
+		if err := instantiate(n, t.Template()); err != nil {
+			return err
+		}
+	}
+	if err := bindAttrs(n, false); err != nil {
+		return err
+	}
+	if err := bindChildren(n); err != nil {
+		return err
+	}
+	if i, ok := n.(Initializer); ok {
+		if err := i.Init(); err != nil {
+			return &ComponentError{Method: "Init", Path: Path(n), Span: n.GetSpan(), Err: err}
+		}
+	}
+	n.base().phase = phaseInit
+	return nil
+}
+
+func postInitNode(n Node) error {
+	if n.base().phase >= phasePostInit {
+		return nil
+	}
+	if err := checkContext(n); err != nil {
+		return err
+	}
+	if i, ok := n.(PostInitializer); ok {
+		if err := i.PostInit(); err != nil {
+			if _, ok := n.(builtin); ok {
+				// Built-in elements name the path themselves.
+				return err
+			}
+			return &ComponentError{Method: "PostInit", Path: Path(n), Span: n.GetSpan(), Err: err}
+		}
+	}
+	n.base().phase = phasePostInit
+	return nil
+}
+
+// walkPostOrder calls f for the descendants of n and then for n. The next
+// sibling is read before f is called on a node, so f may move or remove the
+// node it is given. The content of inert built-in elements is skipped.
+func walkPostOrder(n Node, f func(Node) error) error {
+	if isInert(n) {
+		return f(n)
+	}
+	for c := n.GetFirstChild(); c != nil; {
+		next := c.GetNextSibling()
+		if err := walkPostOrder(c, f); err != nil {
+			return err
+		}
+		c = next
+	}
+	return f(n)
+}
+
+// walkPreOrder calls f for n and then for its descendants. Children are read
+// after f returns, so f may add children to the node it is given, and the
+// content of a built-in element is visited once f has evaluated it.
+func walkPreOrder(n Node, f func(Node) error) error {
+	if err := f(n); err != nil {
+		return err
+	}
+	if isInert(n) {
+		return nil
+	}
+	for c := n.GetFirstChild(); c != nil; {
+		next := c.GetNextSibling()
+		if err := walkPreOrder(c, f); err != nil {
+			return err
+		}
+		c = next
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package nml
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type lifecycleNode struct {
+	*NodeStruct
+	log *[]string
+}
+
+func (n *lifecycleNode) name() string {
+	id, _ := attrValue(n, "id")
+	return id
+}
+
+func (n *lifecycleNode) Init() error {
+	*n.log = append(*n.log, "Init "+n.name())
+	return nil
+}
+
+func (n *lifecycleNode) PostInit() error {
+	*n.log = append(*n.log, "PostInit "+n.name())
+	return nil
+}
+
+func (n *lifecycleNode) PreRender() error {
+	*n.log = append(*n.log, "PreRender "+n.name())
+	return nil
+}
+
+func (n *lifecycleNode) PostRender() error {
+	*n.log = append(*n.log, "PostRender "+n.name())
+	return nil
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	var log []string
+	r := NewRegistry(nil)
+	r.Register("x-node", func(node *NodeStruct) Node {
+		return &lifecycleNode{NodeStruct: node, log: &log}
+	})
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(`<x-node id="a"><x-node id="b"><x-node id="c"></x-node></x-node><x-node id="d"></x-node></x-node>`), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Render(ioutil.Discard, nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Init c", "Init b", "Init d", "Init a",
+		"PostInit a", "PostInit b", "PostInit c", "PostInit d",
+		"PreRender a", "PreRender b", "PreRender c", "PostRender c", "PostRender b", "PreRender d", "PostRender d", "PostRender a",
+	}
+	if strings.Join(log, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got  %s\nwant %s", strings.Join(log, ", "), strings.Join(want, ", "))
+	}
+
+	// The init phases run only once, even if the tree is walked again.
+	log = nil
+	if err := initTree(nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 0 {
+		t.Errorf("second initTree: got %s, want nothing", strings.Join(log, ", "))
+	}
+}
+
+type failingNode struct {
+	*NodeStruct
+}
+
+func (n *failingNode) PreRender() error {
+	return errors.New("fetch failed")
+}
+
+func TestRenderError(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Register("x-fail", func(node *NodeStruct) Node {
+		return &failingNode{NodeStruct: node}
+	})
+	doc, err := Parse(nil, strings.NewReader(`<div id="a"><x-fail id="b"></x-fail></div>`), r.Lookup, nil, Spans())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Render(ioutil.Discard, doc)
+	want := "nml: PreRender html>body>div#a>x-fail#b at 1:13: fetch failed"
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %s", err, want)
+	}
+	if ce, ok := err.(*ComponentError); !ok || ce.Path != "html>body>div#a>x-fail#b" {
+		t.Errorf("got %#v, want a *ComponentError", err)
+	}
+}
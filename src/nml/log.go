@@ -0,0 +1,36 @@
+package nml
+
+import (
+	"common"
+)
+
+// nodeLogger is the Logger of a node. It tags every line with the path of the
+// node, as "path", so that the lines logged by a component say which instance
+// logged them. The path is worked out when the line is logged, so it reflects
+// where the node is by then.
+type nodeLogger struct {
+	n *NodeStruct
+	l common.Logger
+}
+
+func (l *nodeLogger) Debug(msg string, kv ...interface{}) { l.l.Debug(msg, l.fields(kv)...) }
+func (l *nodeLogger) Info(msg string, kv ...interface{})  { l.l.Info(msg, l.fields(kv)...) }
+func (l *nodeLogger) Warn(msg string, kv ...interface{})  { l.l.Warn(msg, l.fields(kv)...) }
+func (l *nodeLogger) Error(msg string, kv ...interface{}) { l.l.Error(msg, l.fields(kv)...) }
+
+func (l *nodeLogger) fields(kv []interface{}) []interface{} {
+	return append([]interface{}{"path", Path(l.n)}, kv...)
+}
+
+// setLogger sets the Logger of n to l, tagged with the path of n. If l is the
+// Logger of another node, its tagging is replaced rather than nested. A nil l
+// means common.Discard.
+func (n *NodeStruct) setLogger(l common.Logger) {
+	if nl, ok := l.(*nodeLogger); ok {
+		l = nl.l
+	}
+	if l == nil {
+		l = common.Discard
+	}
+	n.Logger = &nodeLogger{n, l}
+}
@@ -0,0 +1,39 @@
+package nml
+
+import (
+	"common"
+	"strings"
+	"testing"
+)
+
+type logTag struct {
+	*NodeStruct
+}
+
+func (n *logTag) Init() error {
+	n.Logger.Info("init", "children", n.FirstChild != nil)
+	return nil
+}
+
+func TestNodeLogger(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Register("x-log", func(node *NodeStruct) Node {
+		return &logTag{NodeStruct: node}
+	})
+	rec := new(common.Recorder)
+	_, err := Parse(nil, strings.NewReader(`<div id="a"><x-log id="b"><x-log></x-log></x-log></div>`), r.Lookup, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range rec.Entries() {
+		got = append(got, e.String())
+	}
+	want := []string{
+		"INFO init path=html>body>div#a>x-log#b>x-log children=false",
+		"INFO init path=html>body>div#a>x-log#b children=true",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
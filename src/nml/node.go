@@ -7,6 +7,7 @@ package nml
 import (
 	"common"
 	"nml/atom"
+	"strings"
 )
 
 // A NodeType is the type of a Node.
@@ -47,10 +48,14 @@ type Node interface {
 	SetNamespace(namespace string)
 	SetAttr(attr []Attribute)
 
-	clone(lookup func (node *NodeStruct) Node) Node
+	GetContext() *Context
+	SetContext(ctx *Context)
+
+	GetSpan() Span
+	SetSpan(span Span)
 
-	Init() error
-	Render()
+	clone(lookup func (node *NodeStruct) Node) Node
+	base() *NodeStruct
 }
 
 // Section 12.2.3.3 says "scope markers are inserted when entering applet
@@ -75,7 +80,21 @@ type NodeStruct struct {
 	Data      string
 	Namespace string
 	Attr      []Attribute
-	Logger    *common.Logger
+	Logger    common.Logger
+	Context   *Context
+	// Span is where the node was parsed from. It is zero for nodes that
+	// were not made by the parser, or were parsed without the Spans
+	// option.
+	Span Span
+
+	// phase is how far through the init phases the node has got.
+	phase phase
+	// registry is the Registry that created the node, if any.
+	registry *Registry
+	// templates are the IDs of the templates that the node is a copy of
+	// content from, outermost first, for catching templates that include
+	// themselves.
+	templates []string
 }
 
 func (n *NodeStruct) GetParent() Node {return n.Parent}
@@ -98,15 +117,57 @@ func (n *NodeStruct) SetDataAtom(dataAtom atom.Atom) {n.DataAtom = dataAtom}
 func (n *NodeStruct) SetData(data string) {n.Data = data}
 func (n *NodeStruct) SetNamespace(namespace string) {n.Namespace = namespace}
 func (n *NodeStruct) SetAttr(attr []Attribute) {n.Attr = attr}
-func (n *NodeStruct) Render() { }
-func (n *NodeStruct) Init() error {
-	for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
-		err := c.Init()
-		if err != nil {
-			return err
+func (n *NodeStruct) GetContext() *Context {return n.Context}
+func (n *NodeStruct) SetContext(ctx *Context) {n.Context = ctx}
+func (n *NodeStruct) GetSpan() Span {return n.Span}
+func (n *NodeStruct) SetSpan(span Span) {n.Span = span}
+func (n *NodeStruct) base() *NodeStruct {return n}
+
+// attrValue returns the value of the attribute of n with the given key.
+func attrValue(n Node, key string) (string, bool) {
+	for _, a := range n.GetAttr() {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
 		}
 	}
-	return nil
+	return "", false
+}
+
+// elementName returns a short CSS-like description of n for use in error
+// messages, e.g. "my-bio#Me".
+func elementName(n Node) string {
+	switch n.GetType() {
+	case DocumentNode:
+		return "#document"
+	case TextNode:
+		return "#text"
+	case CommentNode:
+		return "#comment"
+	case DoctypeNode:
+		return "#doctype"
+	}
+	s := n.GetData()
+	if id, _ := attrValue(n, "id"); id != "" {
+		s += "#" + id
+	}
+	return s
+}
+
+// Path returns the element names from the root of n's tree down to n,
+// separated by '>', e.g. "html>body>my-tag#Root>my-bio#Me". The document node
+// is left out.
+func Path(n Node) string {
+	var names []string
+	for ; n != nil; n = n.GetParent() {
+		if n.GetType() == DocumentNode {
+			break
+		}
+		names = append(names, elementName(n))
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, ">")
 }
 
 // InsertBefore inserts newChild as a child of n, immediately before oldChild
@@ -199,19 +260,50 @@ func reparentChildren(dst, src Node) {
 	}
 }
 
-// clone returns a new node with the same type, data and attributes.
-// The clone has no parent, no siblings and no children.
+// clone returns a new node with the same type, data, namespace, attributes,
+// logger, context and span. The clone has no parent, no siblings and no children.
 func (n *NodeStruct) clone(lookup func (node *NodeStruct) Node) Node {
 
 	attr := make([]Attribute, len(n.GetAttr()))
 	copy(attr, n.GetAttr())
 
-	m := lookup(&NodeStruct{
+	m := &NodeStruct{
 		Type: n.GetType(),
 		DataAtom: n.GetDataAtom(),
 		Data:     n.GetData(),
+		Namespace: n.GetNamespace(),
 		Attr:     attr,
-	})
+		Context:  n.Context,
+		Span:     n.Span,
+	}
+	m.setLogger(n.Logger)
+	return lookupElement(lookup, m)
+}
+
+// Cloner is implemented by components with Go fields of their own that
+// CloneTree should carry over to the copy. CloneFields is called on the
+// original with the copy, once the copy's children have been cloned. dst has
+// the type returned by lookup, which is normally the type of the original.
+type Cloner interface {
+	CloneFields(dst Node)
+}
+
+// CloneTree returns a deep copy of n and its descendants. Each node is created
+// with lookup, so the copy consists of the component types that lookup
+// chooses, and copies the type, data, namespace and attributes of the
+// original. Go fields of components are not copied unless the component
+// implements Cloner.
+//
+// The copy has no parent and no siblings, and has not been initialised: it
+// is initialised with the tree it is added to, or by the caller.
+func CloneTree(n Node, lookup func(node *NodeStruct) Node) Node {
+	m := n.clone(lookup)
+	for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+		AppendChild(m, CloneTree(c, lookup))
+	}
+	if c, ok := n.(Cloner); ok {
+		c.CloneFields(m)
+	}
 	return m
 }
 
@@ -49,7 +49,86 @@ type parser struct {
 	context Node
 	// this is a lookup function that takes the tag name and returns the node
 	lookup func(node *NodeStruct) Node
-	logger *common.Logger
+	logger common.Logger
+	// ctx is the Context that is set on every node.
+	ctx *Context
+	// errs collects the parse errors, if they were asked for with
+	// CollectErrors.
+	errs *[]ParseError
+	// source is the document ID put in the span of every node.
+	source string
+	// implied is whether the current token is implied rather than in the
+	// input, so that the nodes it makes get empty spans.
+	implied bool
+	// spans is whether to record the span of each node.
+	spans bool
+	// open is the stack of open elements before the current token, for
+	// finding the elements that the token closes. It is only kept when
+	// spans are recorded or the parse is strict.
+	open nodeStack
+	// strict is whether the first parse error, or the first place where the
+	// tree would differ from the nesting in the source, stops the parse.
+	// err is that error.
+	strict bool
+	err    *ParseError
+	// classify returns a node for an element name, whose Category is that
+	// of custom elements with the name. It is lookup unless the caller
+	// says otherwise. categories caches its answers.
+	classify   func(node *NodeStruct) Node
+	categories map[string]Category
+}
+
+// A ParseOption changes how Parse, ParseFragment and ParseFragmentBody parse
+// their input.
+type ParseOption func(p *parser)
+
+// CollectErrors returns a ParseOption that appends each error the parser
+// recovers from to *errs, in the order they are found. The tree is the same
+// as without the option.
+func CollectErrors(errs *[]ParseError) ParseOption {
+	return func(p *parser) {
+		p.errs = errs
+	}
+}
+
+// Strict returns a ParseOption that makes the parse fail with a *ParseError
+// wherever the tree would not match the nesting of the tags in the source:
+// at any parse error, such as content moved out of a table or a formatting
+// element split up by the adoption agency algorithm, at any element the
+// parser would have to imply, such as a missing <html>, <head>, <body> or
+// <tbody>, and at any element closed by something other than its end tag,
+// such as a <p> closed by a <div>. Without it, the parser recovers as a
+// browser would.
+func Strict() ParseOption {
+	return func(p *parser) {
+		p.strict = true
+	}
+}
+
+// classifyWith returns a ParseOption that makes the parser find the Category
+// of custom elements with f, rather than with the lookup function it builds
+// nodes with.
+func classifyWith(f func(node *NodeStruct) Node) ParseOption {
+	return func(p *parser) {
+		p.classify = f
+	}
+}
+
+// Spans returns a ParseOption that records where each node was parsed from in
+// its Span. Without it, nodes have zero spans.
+func Spans() ParseOption {
+	return func(p *parser) {
+		p.spans = true
+	}
+}
+
+// SourceID returns a ParseOption that sets the Source of the span of every
+// node to id, which is normally the ID of the document being parsed, and of
+// the parse errors.
+func SourceID(id string) ParseOption {
+	return func(p *parser) {
+		p.source = id
+	}
 }
 
 func (p *parser) top() Node {
@@ -117,39 +196,81 @@ func (p *parser) indexOfElementInScope(s scope, matchTags ...a.Atom) int {
 					return i
 				}
 			}
-			switch s {
-			case defaultScope:
-				// No-op.
-			case listItemScope:
-				if tagAtom == a.Ol || tagAtom == a.Ul {
-					return -1
-				}
-			case buttonScope:
-				if tagAtom == a.Button {
-					return -1
-				}
-			case tableScope:
-				if tagAtom == a.Html || tagAtom == a.Table {
-					return -1
-				}
-			case selectScope:
-				if tagAtom != a.Optgroup && tagAtom != a.Option {
-					return -1
-				}
-			default:
-				panic("unreachable")
-			}
 		}
+		if p.stopsScope(s, p.oe[i]) {
+			return -1
+		}
+	}
+	return -1
+}
+
+// indexOfCustomInScope is like indexOfElementInScope, but looks for the
+// custom element named name, since custom elements have no atom.
+func (p *parser) indexOfCustomInScope(s scope, name string) int {
+	for i := len(p.oe) - 1; i >= 0; i-- {
+		if isCustom(p.oe[i]) && p.oe[i].GetData() == name {
+			return i
+		}
+		if p.stopsScope(s, p.oe[i]) {
+			return -1
+		}
+	}
+	return -1
+}
+
+// nodeInScope is like elementInScope, but looks for n itself.
+func (p *parser) nodeInScope(s scope, n Node) bool {
+	for i := len(p.oe) - 1; i >= 0; i-- {
+		if p.oe[i] == n {
+			return true
+		}
+		if p.stopsScope(s, p.oe[i]) {
+			return false
+		}
+	}
+	return false
+}
+
+// stopsScope reports whether n, an element on the stack of open elements, is
+// one of the scope's stop tags, beyond which elements are out of scope.
+// Custom elements of the Block category are stop tags wherever the standard
+// special elements such as <object> are.
+func (p *parser) stopsScope(s scope, n Node) bool {
+	tagAtom := n.GetDataAtom()
+	if n.GetNamespace() == "" {
 		switch s {
-		case defaultScope, listItemScope, buttonScope:
-			for _, t := range defaultScopeStopTags[p.oe[i].GetNamespace()] {
-				if t == tagAtom {
-					return -1
-				}
+		case defaultScope:
+			// No-op.
+		case listItemScope:
+			if tagAtom == a.Ol || tagAtom == a.Ul {
+				return true
+			}
+		case buttonScope:
+			if tagAtom == a.Button {
+				return true
 			}
+		case tableScope:
+			if tagAtom == a.Html || tagAtom == a.Table {
+				return true
+			}
+		case selectScope:
+			if tagAtom != a.Optgroup && tagAtom != a.Option {
+				return true
+			}
+		default:
+			panic("unreachable")
 		}
 	}
-	return -1
+	switch s {
+	case defaultScope, listItemScope, buttonScope:
+		for _, t := range defaultScopeStopTags[n.GetNamespace()] {
+			if t == tagAtom {
+				return true
+			}
+		}
+		return p.is(n, Block)
+	}
+	return false
 }
 
 // elementInScope is like popUntil, except that it doesn't modify the stack of
@@ -160,9 +281,16 @@ func (p *parser) elementInScope(s scope, matchTags ...a.Atom) bool {
 
 // clearStackToContext pops elements off the stack of open elements until a
 // scope-defined element is found.
+//
+// Custom elements of the TableContext category are part of every table
+// context, so that the table content inside them stays there.
 func (p *parser) clearStackToContext(s scope) {
 	for i := len(p.oe) - 1; i >= 0; i-- {
 		tagAtom := p.oe[i].GetDataAtom()
+		if p.is(p.oe[i], TableContext) {
+			p.oe = p.oe[:i+1]
+			return
+		}
 		switch s {
 		case tableScope:
 			if tagAtom == a.Html || tagAtom == a.Table {
@@ -239,6 +367,11 @@ func (p *parser) shouldFosterParent() bool {
 // fosterParent adds a child node according to the foster parenting rules.
 // Section 12.2.5.3, "foster parenting".
 func (p *parser) fosterParent(n Node) {
+	if n.GetType() == TextNode {
+		p.parseError("foster-parented", "text %q moved out of <table>", n.GetData())
+	} else {
+		p.parseError("foster-parented", "<%s> moved out of <table>", n.GetData())
+	}
 	var table, parent, prev Node
 	var i int
 	for i = len(p.oe) - 1; i >= 0; i-- {
@@ -279,7 +412,7 @@ func (p *parser) addText(text string) {
 	}
 
 	if p.shouldFosterParent() {
-		p.fosterParent(p.lookup(&NodeStruct{
+		p.fosterParent(p.newNode(&NodeStruct{
 			Type: TextNode,
 			Data: text,
 		}))
@@ -289,9 +422,13 @@ func (p *parser) addText(text string) {
 	t := p.top()
 	if n := t.GetLastChild(); n != nil && n.GetType() == TextNode {
 		n.SetData(n.GetData() + text)
+		if span := n.GetSpan(); !span.IsZero() {
+			_, span.End = p.tokenizer.Span()
+			n.SetSpan(span)
+		}
 		return
 	}
-	p.addChild(p.lookup(&NodeStruct{
+	p.addChild(p.newNode(&NodeStruct{
 		Type: TextNode,
 		Data: text,
 	}))
@@ -299,15 +436,78 @@ func (p *parser) addText(text string) {
 
 // addElement adds a child element based on the current token.
 func (p *parser) addElement() {
-	p.addChild(p.lookup(&NodeStruct{
+	p.addElementNS("")
+}
+
+// addElementNS is like addElement, but creates the element in the given
+// namespace. The namespace is set before lookup is called, so that lookup can
+// tell an SVG <title> from an HTML one.
+func (p *parser) addElementNS(namespace string) {
+	p.addChild(p.newNode(&NodeStruct{
 		Type: ElementNode,
 		DataAtom: p.tok.DataAtom,
 		Data:     p.tok.Data,
+		Namespace: namespace,
 		Attr:     p.tok.Attr,
-		Logger:   p.logger,
 	}))
 }
 
+// newNode returns the Node for node, which it puts in the parser's context.
+// Every node the parser creates goes through here.
+func (p *parser) newNode(node *NodeStruct) Node {
+	node.Context = p.ctx
+	node.setLogger(p.logger)
+	if start, end := p.tokenizer.Span(); start.Line > 0 {
+		if p.implied {
+			end = start
+			if node.Type == ElementNode {
+				p.strictError("implied-element", "<%s> is implied but not in the source", node.Data)
+			}
+		}
+		if p.spans {
+			node.Span = Span{Source: p.source, Start: start, End: end}
+		}
+	}
+	return lookupElement(p.lookup, node)
+}
+
+// setEnds ends the span of each element that was open before the current
+// token but is not now: at the end of the token if it is the element's end
+// tag, or else at its start. tok is the token as it was read, before the
+// insertion modes changed it. In strict mode, it reports the elements closed
+// by anything but their end tag.
+func (p *parser) setEnds(tok Token) {
+	// Most tokens close no elements, or only some at the top of the
+	// stack, so only what follows the part that is unchanged is looked
+	// at.
+	k := 0
+	for k < len(p.open) && k < len(p.oe) && p.open[k] == p.oe[k] {
+		k++
+	}
+	start, end := p.tokenizer.Span()
+	still := p.oe[k:]
+	for _, n := range p.open[k:] {
+		if still.index(n) != -1 {
+			continue
+		}
+		span := n.GetSpan()
+		if p.spans && span.IsZero() {
+			// The element was implied, so it has no span to end.
+			continue
+		}
+		span.End = start
+		if tok.Type == EndTagToken && tok.Data == n.GetData() {
+			span.End = end
+		} else if tok.Type != ErrorToken {
+			p.strictError("implied-end-tag", "<%s> is closed by %s before its end tag", n.GetData(), tokenName(tok))
+		}
+		if p.spans {
+			n.SetSpan(span)
+		}
+	}
+	p.open = append(p.open[:k], p.oe[k:]...)
+}
+
 // Section 12.2.3.3.
 func (p *parser) addFormattingElement() {
 	tagAtom, attr := p.tok.DataAtom, p.tok.Attr
@@ -327,7 +527,7 @@ findIdenticalElements:
 		if n.GetNamespace() != "" {
 			continue
 		}
-		if n.GetDataAtom() != tagAtom {
+		if n.GetDataAtom() != tagAtom || n.GetData() != p.tok.Data {
 			continue
 		}
 		if len(n.GetAttr()) != len(attr) {
@@ -394,11 +594,92 @@ func (p *parser) reconstructActiveFormattingElements() {
 	}
 }
 
+// isSpecialElement reports whether element is in the special category of
+// section 12.2.3.2, or is a custom element of the Block category.
+func (p *parser) isSpecialElement(element Node) bool {
+	switch element.GetNamespace() {
+	case "", "html":
+		return isSpecialElementMap[element.GetData()] || p.is(element, Block)
+	case "svg":
+		return element.GetData() == "foreignObject"
+	}
+	return false
+}
+
 // Section 12.2.4.
 func (p *parser) acknowledgeSelfClosingTag() {
 	p.hasSelfClosingToken = false
 }
 
+// parseError records a parse error at the start of the current token, if
+// errors are being collected, and stops the parse in strict mode.
+func (p *parser) parseError(code, format string, args ...interface{}) {
+	if p.errs == nil && !p.strict || p.err != nil {
+		return
+	}
+	pos, _ := p.tokenizer.Span()
+	e := ParseError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+		Source:  p.source,
+		Line:    pos.Line,
+		Column:  pos.Column,
+	}
+	if p.errs != nil {
+		*p.errs = append(*p.errs, e)
+	}
+	if p.strict {
+		p.err = &e
+	}
+}
+
+// strictError is parseError for the places where the tree would differ from
+// the source that are not parse errors in lenient mode.
+func (p *parser) strictError(code, format string, args ...interface{}) {
+	if p.strict {
+		p.parseError(code, format, args...)
+	}
+}
+
+// ignoreToken records the parse error for a token that is ignored where it
+// appears.
+func (p *parser) ignoreToken() {
+	switch p.tok.Type {
+	case DoctypeToken:
+		p.parseError("unexpected-doctype", "unexpected doctype")
+	case StartTagToken:
+		p.parseError("unexpected-start-tag", "unexpected <%s>", p.tok.Data)
+	case EndTagToken:
+		p.parseError("unexpected-end-tag", "unexpected </%s>", p.tok.Data)
+	case TextToken:
+		p.parseError("unexpected-text", "unexpected text %q", p.tok.Data)
+	}
+}
+
+// checkEndTag records the parse error, if any, for an end tag that closes the
+// element in scope s matching matchTags: either there is no such element, or
+// elements other than those with implied end tags are open inside it.
+func (p *parser) checkEndTag(s scope, matchTags ...a.Atom) {
+	i := p.indexOfElementInScope(s, matchTags...)
+	if i == -1 {
+		p.ignoreToken()
+		return
+	}
+	p.checkEndTagAt(i)
+}
+
+// checkEndTagAt is checkEndTag for an end tag that closes p.oe[i].
+func (p *parser) checkEndTagAt(i int) {
+	for _, n := range p.oe[i+1:] {
+		switch n.GetDataAtom() {
+		case a.Dd, a.Dt, a.Li, a.Option, a.Optgroup, a.P, a.Rp, a.Rt:
+			continue
+		}
+		p.parseError("misnested-tag", "</%s> closes <%s> too", p.tok.Data, n.GetData())
+		return
+	}
+}
+
 // An insertion mode (section 12.2.3.1) is the state transition function from
 // a particular state in the HTML5 parser's state machine. It updates the
 // parser's fields depending on parser.tok (where ErrorToken means EOF).
@@ -466,13 +747,13 @@ func initialIM(p *parser) bool {
 			return true
 		}
 	case CommentToken:
-		AppendChild(p.doc, p.lookup(&NodeStruct{
+		AppendChild(p.doc, p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data: p.tok.Data,
 		}))
 		return true
 	case DoctypeToken:
-		n, quirks := parseDoctype(p.tok.Data, p.lookup)
+		n, quirks := parseDoctype(p.tok.Data, p.newNode)
 		AppendChild(p.doc, n)
 		p.quirks = quirks
 		p.im = beforeHTMLIM
@@ -487,7 +768,7 @@ func initialIM(p *parser) bool {
 func beforeHTMLIM(p *parser) bool {
 	switch p.tok.Type {
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	case TextToken:
 		p.tok.Data = strings.TrimLeft(p.tok.Data, whitespace)
@@ -507,11 +788,11 @@ func beforeHTMLIM(p *parser) bool {
 			p.parseImpliedToken(StartTagToken, a.Html, a.Html.String())
 			return false
 		default:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case CommentToken:
-		AppendChild(p.doc, p.lookup(&NodeStruct{
+		AppendChild(p.doc, p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data: p.tok.Data,
 		}))
@@ -546,17 +827,17 @@ func beforeHeadIM(p *parser) bool {
 			p.parseImpliedToken(StartTagToken, a.Head, a.Head.String())
 			return false
 		default:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data: p.tok.Data,
 		}))
 		return true
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	}
 
@@ -592,7 +873,7 @@ func inHeadIM(p *parser) bool {
 			p.im = textIM
 			return true
 		case a.Head:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case EndTagToken:
@@ -608,17 +889,17 @@ func inHeadIM(p *parser) bool {
 			p.parseImpliedToken(EndTagToken, a.Head, a.Head.String())
 			return false
 		default:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data: p.tok.Data,
 		}))
 		return true
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	}
 
@@ -657,7 +938,7 @@ func afterHeadIM(p *parser) bool {
 			defer p.oe.remove(p.head)
 			return inHeadIM(p)
 		case a.Head:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case EndTagToken:
@@ -665,17 +946,17 @@ func afterHeadIM(p *parser) bool {
 		case a.Body, a.Html, a.Br:
 			// Drop down to creating an implied <body> tag.
 		default:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data: p.tok.Data,
 		}))
 		return true
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	}
 
@@ -744,7 +1025,7 @@ func inBodyIM(p *parser) bool {
 			}
 		case a.Frameset:
 			if !p.framesetOK || len(p.oe) < 2 || p.oe[1].GetDataAtom() != a.Body {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 			body := p.oe[1]
@@ -786,7 +1067,7 @@ func inBodyIM(p *parser) bool {
 				case a.Address, a.Div, a.P:
 					continue
 				default:
-					if !isSpecialElement(node) {
+					if !p.isSpecialElement(node) {
 						continue
 					}
 				}
@@ -804,7 +1085,7 @@ func inBodyIM(p *parser) bool {
 				case a.Address, a.Div, a.P:
 					continue
 				default:
-					if !isSpecialElement(node) {
+					if !p.isSpecialElement(node) {
 						continue
 					}
 				}
@@ -886,7 +1167,7 @@ func inBodyIM(p *parser) bool {
 			return false
 		case a.Isindex:
 			if p.form != nil {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 			action := ""
@@ -913,7 +1194,7 @@ func inBodyIM(p *parser) bool {
 			p.parseImpliedToken(StartTagToken, a.Hr, a.Hr.String())
 			p.parseImpliedToken(StartTagToken, a.Label, a.Label.String())
 			p.addText(prompt)
-			p.addChild(p.lookup(&NodeStruct{
+			p.addChild(p.newNode(&NodeStruct{
 				Type: ElementNode,
 				DataAtom: a.Input,
 				Data:     a.Input.String(),
@@ -969,17 +1250,19 @@ func inBodyIM(p *parser) bool {
 				adjustAttributeNames(p.tok.Attr, svgAttributeAdjustments)
 			}
 			adjustForeignAttributes(p.tok.Attr)
-			p.addElement()
-			p.top().SetNamespace(p.tok.Data)
+			p.addElementNS(p.tok.Data)
 			if p.hasSelfClosingToken {
 				p.oe.pop()
 				p.acknowledgeSelfClosingTag()
 			}
 			return true
 		case a.Caption, a.Col, a.Colgroup, a.Frame, a.Head, a.Tbody, a.Td, a.Tfoot, a.Th, a.Thead, a.Tr:
-			// Ignore the token.
+			p.ignoreToken()
 		default:
 			p.reconstructActiveFormattingElements()
+			if p.tok.DataAtom == 0 {
+				return p.addCustomElement()
+			}
 			p.addElement()
 		}
 	case EndTagToken:
@@ -995,31 +1278,37 @@ func inBodyIM(p *parser) bool {
 			}
 			return true
 		case a.Address, a.Article, a.Aside, a.Blockquote, a.Button, a.Center, a.Details, a.Dir, a.Div, a.Dl, a.Fieldset, a.Figcaption, a.Figure, a.Footer, a.Header, a.Hgroup, a.Listing, a.Menu, a.Nav, a.Ol, a.Pre, a.Section, a.Summary, a.Ul:
+			p.checkEndTag(defaultScope, p.tok.DataAtom)
 			p.popUntil(defaultScope, p.tok.DataAtom)
 		case a.Form:
 			node := p.form
 			p.form = nil
 			i := p.indexOfElementInScope(defaultScope, a.Form)
 			if node == nil || i == -1 || p.oe[i] != node {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 			p.generateImpliedEndTags()
 			p.oe.remove(node)
 		case a.P:
+			p.checkEndTag(buttonScope, a.P)
 			if !p.elementInScope(buttonScope, a.P) {
 				p.parseImpliedToken(StartTagToken, a.P, a.P.String())
 			}
 			p.popUntil(buttonScope, a.P)
 		case a.Li:
+			p.checkEndTag(listItemScope, a.Li)
 			p.popUntil(listItemScope, a.Li)
 		case a.Dd, a.Dt:
+			p.checkEndTag(defaultScope, p.tok.DataAtom)
 			p.popUntil(defaultScope, p.tok.DataAtom)
 		case a.H1, a.H2, a.H3, a.H4, a.H5, a.H6:
+			p.checkEndTag(defaultScope, a.H1, a.H2, a.H3, a.H4, a.H5, a.H6)
 			p.popUntil(defaultScope, a.H1, a.H2, a.H3, a.H4, a.H5, a.H6)
 		case a.A, a.B, a.Big, a.Code, a.Em, a.Font, a.I, a.Nobr, a.S, a.Small, a.Strike, a.Strong, a.Tt, a.U:
 			p.inBodyEndTagFormatting(p.tok.DataAtom)
 		case a.Applet, a.Marquee, a.Object:
+			p.checkEndTag(defaultScope, p.tok.DataAtom)
 			if p.popUntil(defaultScope, p.tok.DataAtom) {
 				p.clearActiveFormattingElements()
 			}
@@ -1027,18 +1316,69 @@ func inBodyIM(p *parser) bool {
 			p.tok.Type = StartTagToken
 			return false
 		default:
-			p.inBodyEndTagOther(p.tok.DataAtom)
+			var c Category
+			if p.tok.DataAtom == 0 {
+				c = p.category(p.tok.Data)
+			}
+			switch {
+			case c&Block != 0:
+				i := p.indexOfCustomInScope(defaultScope, p.tok.Data)
+				if i == -1 {
+					p.ignoreToken()
+					break
+				}
+				p.checkEndTagAt(i)
+				p.oe = p.oe[:i]
+				p.clearActiveFormattingElements()
+			case c&Formatting != 0:
+				p.inBodyEndTagFormatting(0)
+			default:
+				p.inBodyEndTagOther(p.tok.DataAtom)
+			}
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
+	case DoctypeToken:
+		p.ignoreToken()
 	}
 
 	return true
 }
 
+// addCustomElement adds a custom element for the current start tag, according
+// to its Category. It returns whether the token was consumed.
+func (p *parser) addCustomElement() bool {
+	switch c := p.category(p.tok.Data); {
+	case c&SelfClosing != 0 && p.hasSelfClosingToken:
+		p.addElement()
+		p.oe.pop()
+		p.acknowledgeSelfClosingTag()
+	case c&Block != 0:
+		p.addElement()
+		p.afe = append(p.afe, p.lookup(&scopeMarker))
+		p.framesetOK = false
+	case c&Formatting != 0:
+		p.addFormattingElement()
+	case c&Void != 0:
+		p.addElement()
+		p.oe.pop()
+		p.acknowledgeSelfClosingTag()
+		p.framesetOK = false
+	case c&RawText != 0:
+		p.addElement()
+		p.tokenizer.rawTag = p.tok.Data
+		p.setOriginalIM()
+		p.framesetOK = false
+		p.im = textIM
+	default:
+		p.addElement()
+	}
+	return true
+}
+
 func (p *parser) inBodyEndTagFormatting(tagAtom a.Atom) {
 	// This is the "adoption agency" algorithm, described at
 	// http://www.whatwg.org/specs/web-apps/current-work/multipage/tokenization.html#adoptionAgency
@@ -1055,7 +1395,7 @@ func (p *parser) inBodyEndTagFormatting(tagAtom a.Atom) {
 			if p.afe[j].GetType() == scopeMarkerNode {
 				break
 			}
-			if p.afe[j].GetDataAtom() == tagAtom {
+			if p.afe[j].GetDataAtom() == tagAtom && (tagAtom != 0 || p.afe[j].GetData() == p.tok.Data) {
 				formattingElement = p.afe[j]
 				break
 			}
@@ -1066,23 +1406,27 @@ func (p *parser) inBodyEndTagFormatting(tagAtom a.Atom) {
 		}
 		feIndex := p.oe.index(formattingElement)
 		if feIndex == -1 {
+			p.ignoreToken()
 			p.afe.remove(formattingElement)
 			return
 		}
-		if !p.elementInScope(defaultScope, tagAtom) {
-			// Ignore the tag.
+		if !p.nodeInScope(defaultScope, formattingElement) {
+			p.ignoreToken()
 			return
 		}
 
 		// Steps 5-6. Find the furthest block.
 		var furthestBlock Node
 		for _, e := range p.oe[feIndex:] {
-			if isSpecialElement(e) {
+			if p.isSpecialElement(e) {
 				furthestBlock = e
 				break
 			}
 		}
 		if furthestBlock == nil {
+			if top := p.oe.top(); top != formattingElement && i == 0 {
+				p.parseError("misnested-tag", "</%s> closes <%s> too", p.tok.Data, top.GetData())
+			}
 			e := p.oe.pop()
 			for e != formattingElement {
 				e = p.oe.pop()
@@ -1091,6 +1435,10 @@ func (p *parser) inBodyEndTagFormatting(tagAtom a.Atom) {
 			return
 		}
 
+		if i == 0 {
+			p.parseError("misnested-formatting", "</%s> closes <%s> across <%s>", p.tok.Data, formattingElement.GetData(), furthestBlock.GetData())
+		}
+
 		// Steps 7-8. Find the common ancestor and bookmark node.
 		commonAncestor := p.oe[feIndex-1]
 		bookmark := p.afe.index(formattingElement)
@@ -1166,14 +1514,18 @@ func (p *parser) inBodyEndTagFormatting(tagAtom a.Atom) {
 // inBodyEndTagOther performs the "any other end tag" algorithm for inBodyIM.
 func (p *parser) inBodyEndTagOther(tagAtom a.Atom) {
 	for i := len(p.oe) - 1; i >= 0; i-- {
-		if p.oe[i].GetDataAtom() == tagAtom {
+		if p.oe[i].GetDataAtom() == tagAtom && (tagAtom != 0 || p.oe[i].GetData() == p.tok.Data) {
+			if i != len(p.oe)-1 {
+				p.parseError("misnested-tag", "</%s> closes <%s> too", p.tok.Data, p.oe.top().GetData())
+			}
 			p.oe = p.oe[:i]
-			break
+			return
 		}
-		if isSpecialElement(p.oe[i]) {
+		if p.isSpecialElement(p.oe[i]) {
 			break
 		}
 	}
+	p.ignoreToken()
 }
 
 // Section 12.2.5.4.8.
@@ -1249,7 +1601,7 @@ func inTableIM(p *parser) bool {
 				p.resetInsertionMode()
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Style, a.Script:
 			return inHeadIM(p)
@@ -1264,7 +1616,7 @@ func inTableIM(p *parser) bool {
 			// Otherwise drop down to the default action.
 		case a.Form:
 			if p.form != nil {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 			p.addElement()
@@ -1280,6 +1632,12 @@ func inTableIM(p *parser) bool {
 			p.framesetOK = false
 			p.im = inSelectInTableIM
 			return true
+		case 0:
+			if p.category(p.tok.Data)&TableContext != 0 {
+				// The element goes where it is, and the insertion mode
+				// stays as it is for the table content inside it.
+				return p.addCustomElement()
+			}
 		}
 	case EndTagToken:
 		switch p.tok.DataAtom {
@@ -1288,20 +1646,32 @@ func inTableIM(p *parser) bool {
 				p.resetInsertionMode()
 				return true
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Body, a.Caption, a.Col, a.Colgroup, a.Html, a.Tbody, a.Td, a.Tfoot, a.Th, a.Thead, a.Tr:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
+		case 0:
+			if p.category(p.tok.Data)&TableContext != 0 {
+				i := p.indexOfCustomInScope(tableScope, p.tok.Data)
+				if i == -1 {
+					p.ignoreToken()
+					return true
+				}
+				p.checkEndTagAt(i)
+				p.oe = p.oe[:i]
+				p.resetInsertionMode()
+				return true
+			}
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
 		return true
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	}
 
@@ -1322,7 +1692,7 @@ func inCaptionIM(p *parser) bool {
 				p.im = inTableIM
 				return false
 			} else {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 		case a.Select:
@@ -1346,11 +1716,11 @@ func inCaptionIM(p *parser) bool {
 				p.im = inTableIM
 				return false
 			} else {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 		case a.Body, a.Col, a.Colgroup, a.Html, a.Tbody, a.Td, a.Tfoot, a.Th, a.Thead, a.Tr:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	}
@@ -1371,13 +1741,13 @@ func inColumnGroupIM(p *parser) bool {
 			p.tok.Data = s
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data: p.tok.Data,
 		}))
 		return true
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	case StartTagToken:
 		switch p.tok.DataAtom {
@@ -1398,7 +1768,7 @@ func inColumnGroupIM(p *parser) bool {
 			}
 			return true
 		case a.Col:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	}
@@ -1428,7 +1798,7 @@ func inTableBodyIM(p *parser) bool {
 				p.im = inTableIM
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case EndTagToken:
@@ -1445,14 +1815,14 @@ func inTableBodyIM(p *parser) bool {
 				p.im = inTableIM
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Body, a.Caption, a.Col, a.Colgroup, a.Html, a.Td, a.Th, a.Tr:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1478,7 +1848,7 @@ func inRowIM(p *parser) bool {
 				p.im = inTableBodyIM
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	case EndTagToken:
@@ -1488,24 +1858,24 @@ func inRowIM(p *parser) bool {
 				p.im = inTableBodyIM
 				return true
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Table:
 			if p.popUntil(tableScope, a.Tr) {
 				p.im = inTableBodyIM
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Tbody, a.Tfoot, a.Thead:
 			if p.elementInScope(tableScope, p.tok.DataAtom) {
 				p.parseImpliedToken(EndTagToken, a.Tr, a.Tr.String())
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Body, a.Caption, a.Col, a.Colgroup, a.Html, a.Td, a.Th:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		}
 	}
@@ -1525,7 +1895,7 @@ func inCellIM(p *parser) bool {
 				p.im = inRowIM
 				return false
 			}
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Select:
 			p.reconstructActiveFormattingElements()
@@ -1538,18 +1908,18 @@ func inCellIM(p *parser) bool {
 		switch p.tok.DataAtom {
 		case a.Td, a.Th:
 			if !p.popUntil(tableScope, p.tok.DataAtom) {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 			p.clearActiveFormattingElements()
 			p.im = inRowIM
 			return true
 		case a.Body, a.Caption, a.Col, a.Colgroup, a.Html:
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Table, a.Tbody, a.Tfoot, a.Thead, a.Tr:
 			if !p.elementInScope(tableScope, p.tok.DataAtom) {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 			// Close the cell and reprocess.
@@ -1597,7 +1967,7 @@ func inSelectIM(p *parser) bool {
 			}
 			// In order to properly ignore <textarea>, we need to change the tokenizer mode.
 			p.tokenizer.NextIsNotRawText()
-			// Ignore the token.
+			p.ignoreToken()
 			return true
 		case a.Script:
 			return inHeadIM(p)
@@ -1622,12 +1992,12 @@ func inSelectIM(p *parser) bool {
 			}
 		}
 	case CommentToken:
-		AppendChild(p.doc, p.lookup(&NodeStruct{
+		AppendChild(p.doc, p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
 	case DoctypeToken:
-		// Ignore the token.
+		p.ignoreToken()
 		return true
 	}
 
@@ -1644,7 +2014,7 @@ func inSelectInTableIM(p *parser) bool {
 				p.parseImpliedToken(EndTagToken, a.Select, a.Select.String())
 				return false
 			} else {
-				// Ignore the token.
+				p.ignoreToken()
 				return true
 			}
 		}
@@ -1680,7 +2050,7 @@ func afterBodyIM(p *parser) bool {
 		if len(p.oe) < 1 || p.oe[0].GetDataAtom() != a.Html {
 			panic("html: bad parser state: <html> element not found, in the after-body insertion mode")
 		}
-		AppendChild(p.oe[0], p.lookup(&NodeStruct{
+		AppendChild(p.oe[0], p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1694,7 +2064,7 @@ func afterBodyIM(p *parser) bool {
 func inFramesetIM(p *parser) bool {
 	switch p.tok.Type {
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1735,7 +2105,7 @@ func inFramesetIM(p *parser) bool {
 			}
 		}
 	default:
-		// Ignore the token.
+		p.ignoreToken()
 	}
 	return true
 }
@@ -1744,7 +2114,7 @@ func inFramesetIM(p *parser) bool {
 func afterFramesetIM(p *parser) bool {
 	switch p.tok.Type {
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1774,7 +2144,7 @@ func afterFramesetIM(p *parser) bool {
 			return true
 		}
 	default:
-		// Ignore the token.
+		p.ignoreToken()
 	}
 	return true
 }
@@ -1796,7 +2166,7 @@ func afterAfterBodyIM(p *parser) bool {
 			return inBodyIM(p)
 		}
 	case CommentToken:
-		AppendChild(p.doc, p.lookup(&NodeStruct{
+		AppendChild(p.doc, p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1812,7 +2182,7 @@ func afterAfterBodyIM(p *parser) bool {
 func afterAfterFramesetIM(p *parser) bool {
 	switch p.tok.Type {
 	case CommentToken:
-		AppendChild(p.doc, p.lookup(&NodeStruct{
+		AppendChild(p.doc, p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1839,7 +2209,7 @@ func afterAfterFramesetIM(p *parser) bool {
 	case DoctypeToken:
 		return inBodyIM(p)
 	default:
-		// Ignore the token.
+		p.ignoreToken()
 	}
 	return true
 }
@@ -1856,7 +2226,7 @@ func parseForeignContent(p *parser) bool {
 		p.tok.Data = strings.Replace(p.tok.Data, "\x00", "\ufffd", -1)
 		p.addText(p.tok.Data)
 	case CommentToken:
-		p.addChild(p.lookup(&NodeStruct{
+		p.addChild(p.newNode(&NodeStruct{
 			Type: CommentNode,
 			Data:     p.tok.Data,
 		}))
@@ -1898,8 +2268,7 @@ func parseForeignContent(p *parser) bool {
 		}
 		adjustForeignAttributes(p.tok.Attr)
 		namespace := p.top().GetNamespace()
-		p.addElement()
-		p.top().SetNamespace(namespace)
+		p.addElementNS(namespace)
 		if namespace != "" {
 			// Don't let the tokenizer go into raw text mode in foreign content
 			// (e.g. in an SVG <title> tag).
@@ -1921,7 +2290,7 @@ func parseForeignContent(p *parser) bool {
 		}
 		return true
 	default:
-		// Ignore the token.
+		p.ignoreToken()
 	}
 	return true
 }
@@ -1958,15 +2327,16 @@ func (p *parser) inForeignContent() bool {
 // parseImpliedToken parses a token as though it had appeared in the parser's
 // input.
 func (p *parser) parseImpliedToken(t TokenType, dataAtom a.Atom, data string) {
-	realToken, selfClosing := p.tok, p.hasSelfClosingToken
+	realToken, selfClosing, implied := p.tok, p.hasSelfClosingToken, p.implied
 	p.tok = Token{
 		Type:     t,
 		DataAtom: dataAtom,
 		Data:     data,
 	}
 	p.hasSelfClosingToken = false
+	p.implied = true
 	p.parseCurrentToken()
-	p.tok, p.hasSelfClosingToken = realToken, selfClosing
+	p.tok, p.hasSelfClosingToken, p.implied = realToken, selfClosing, implied
 }
 
 // parseCurrentToken runs the current token through the parsing routines
@@ -1987,18 +2357,25 @@ func (p *parser) parseCurrentToken() {
 	}
 
 	if p.hasSelfClosingToken {
-		// This is a parse error, but ignore it.
+		// This is a parse error, but otherwise ignore it.
+		p.parseError("self-closing-non-void", "<%s/> is not a void element, so the / is ignored", p.tok.Data)
 		p.hasSelfClosingToken = false
 	}
 }
 
 func (p *parser) parse() error {
+	if p.classify == nil {
+		p.classify = p.lookup
+	}
 	// Iterate until EOF. Any other error will cause an early return.
 	var err error
 	for err != io.EOF {
 		// CDATA sections are allowed only in foreign content.
 		n := p.oe.top()
 		p.tokenizer.AllowCDATA(n != nil && n.GetNamespace() != "")
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
 		// Read and parse the next token.
 		p.tokenizer.Next()
 		p.tok = p.tokenizer.Token()
@@ -2007,31 +2384,98 @@ func (p *parser) parse() error {
 			if err != nil && err != io.EOF {
 				return err
 			}
+			p.checkEOF()
 		}
+		tok := p.tok
 		p.parseCurrentToken()
+		if p.spans || p.strict {
+			p.setEnds(tok)
+		}
+		if p.err != nil {
+			return p.err
+		}
+	}
+	// Whatever is still open ends at the end of the input.
+	_, end := p.tokenizer.Span()
+	for _, n := range p.oe {
+		if span := n.GetSpan(); !span.IsZero() {
+			span.End = end
+			n.SetSpan(span)
+		}
 	}
 	return nil
 }
 
+// checkEOF records a parse error for each element that is still open at the
+// end of the input, other than those whose end tags may be left out.
+//
+// In strict mode, only <html>, <head> and <body> may be left open.
+func (p *parser) checkEOF() {
+	for _, n := range p.oe {
+		switch n.GetDataAtom() {
+		case a.Dd, a.Dt, a.Li, a.P, a.Tbody, a.Td, a.Tfoot, a.Th, a.Thead, a.Tr:
+			if !p.strict {
+				continue
+			}
+		case a.Head, a.Body, a.Html:
+			continue
+		}
+		p.parseError("eof-in-element", "<%s> is not closed", n.GetData())
+	}
+}
+
+// tokenName describes t for error messages.
+func tokenName(t Token) string {
+	switch t.Type {
+	case StartTagToken, SelfClosingTagToken:
+		return "<" + t.Data + ">"
+	case EndTagToken:
+		return "</" + t.Data + ">"
+	case TextToken:
+		return "text"
+	case CommentToken:
+		return "a comment"
+	case DoctypeToken:
+		return "a doctype"
+	}
+	return "the end of the input"
+}
+
 // Parse returns the parse tree for the HTML from the given Reader.
-// The input is assumed to be UTF-8 encoded.
-func Parse(r io.Reader, lookup func(node *NodeStruct) Node, logger *common.Logger) (Node, error) {
+// The input is assumed to be UTF-8 encoded. Every node of the tree has ctx as
+// its Context; a nil ctx means Background. The Logger of each node logs to
+// logger, tagging each line with the node's path; a nil logger discards.
+// opts change how the input is parsed; see CollectErrors.
+func Parse(ctx *Context, r io.Reader, lookup func(node *NodeStruct) Node, logger common.Logger, opts ...ParseOption) (Node, error) {
+	doc, err := parse(ctx, r, lookup, logger, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = initTree(doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// parse is like Parse, but does not run the init phases on the tree.
+func parse(ctx *Context, r io.Reader, lookup func(node *NodeStruct) Node, logger common.Logger, opts ...ParseOption) (Node, error) {
 	p := &parser{
 		tokenizer: NewTokenizer(r),
-		doc: lookup(&NodeStruct{
-			Type: DocumentNode,
-		}),
 		scripting:  true,
 		framesetOK: true,
 		im:         initialIM,
 		lookup:     lookup,
 		logger:     logger,
+		ctx:        orBackground(ctx),
 	}
-	err := p.parse()
-	if err != nil {
-		return nil, err
+	for _, opt := range opts {
+		opt(p)
 	}
-	err = p.doc.Init()
+	p.doc = p.newNode(&NodeStruct{
+		Type: DocumentNode,
+	})
+	err := p.parse()
 	if err != nil {
 		return nil, err
 	}
@@ -2040,8 +2484,24 @@ func Parse(r io.Reader, lookup func(node *NodeStruct) Node, logger *common.Logge
 
 // ParseFragment parses a fragment of HTML and returns the nodes that were
 // found. If the fragment is the InnerHTML for an existing element, pass that
-// element in context.
-func ParseFragment(r io.Reader, context Node, lookup func(node *NodeStruct) Node) ([]Node, error) {
+// element in context. The nodes have ctx as their Context, as with Parse.
+func ParseFragment(ctx *Context, r io.Reader, context Node, lookup func(node *NodeStruct) Node, opts ...ParseOption) ([]Node, error) {
+	result, err := parseFragment(ctx, r, context, lookup, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		err := initTree(result[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// parseFragment is like ParseFragment, but does not run the init phases on
+// the nodes it returns.
+func parseFragment(ctx *Context, r io.Reader, context Node, lookup func(node *NodeStruct) Node, opts ...ParseOption) ([]Node, error) {
 	contextTag := ""
 	if context != nil {
 		if context.GetType() != ElementNode {
@@ -2057,16 +2517,20 @@ func ParseFragment(r io.Reader, context Node, lookup func(node *NodeStruct) Node
 	}
 	p := &parser{
 		tokenizer: NewTokenizerFragment(r, contextTag),
-		doc: lookup(&NodeStruct{
-			Type: DocumentNode,
-		}),
 		scripting: true,
 		fragment:  true,
 		context:   context,
 		lookup:    lookup,
+		ctx:       orBackground(ctx),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	p.doc = p.newNode(&NodeStruct{
+		Type: DocumentNode,
+	})
 
-	root := p.lookup(&NodeStruct{
+	root := p.newNode(&NodeStruct{
 		Type: ElementNode,
 		DataAtom: a.Html,
 		Data:     a.Html.String(),
@@ -2099,14 +2563,8 @@ func ParseFragment(r io.Reader, context Node, lookup func(node *NodeStruct) Node
 		result = append(result, c)
 		c = next
 	}
-	for i := range result {
-		err := result[i].Init()
-		if err != nil {
-			return nil, err
-		}
-	}
 	return result, nil
 }
-func ParseFragmentBody(r io.Reader, lookup func(node *NodeStruct) Node) ([]Node, error) {
-	return ParseFragment(r, lookup(&NodeStruct { Type: ElementNode, Data: "body", DataAtom: a.Body }), lookup)
+func ParseFragmentBody(ctx *Context, r io.Reader, lookup func(node *NodeStruct) Node, opts ...ParseOption) ([]Node, error) {
+	return ParseFragment(ctx, r, lookup(&NodeStruct { Type: ElementNode, Data: "body", DataAtom: a.Body }), lookup, opts...)
 }
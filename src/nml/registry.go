@@ -0,0 +1,121 @@
+package nml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A Constructor wraps a freshly created NodeStruct in the Go type that
+// implements the element. The returned Node must embed node.
+type Constructor func(node *NodeStruct) Node
+
+// registryKey identifies an element by namespace and tag name. The namespace
+// uses the same short form as NodeStruct.Namespace: "" for HTML, "svg" or
+// "math" for foreign content.
+type registryKey struct {
+	namespace, name string
+}
+
+// A Registry maps element names to the constructors of the components that
+// implement them. Packages register their components from init functions, and
+// the Registry's Lookup method is passed to Parse, ParseFragment and friends
+// wherever a lookup function is accepted.
+type Registry struct {
+	// Default wraps every node that has no registered constructor: text,
+	// comments, documents and ordinary elements. If nil, the NodeStruct is
+	// returned as is.
+	Default Constructor
+
+	// Templates opens the source of a template, for components created by
+	// the Registry that implement Templated.
+	Templates func(id string) (io.Reader, error)
+
+	// Strict parses templates in strict mode, so that a template fails to
+	// load, rather than being restructured, wherever its tree would not
+	// match the nesting of its tags. See Strict.
+	Strict bool
+
+	mu           sync.RWMutex
+	constructors map[registryKey]Constructor
+	templates    map[string][]Node
+}
+
+// NewRegistry returns an empty Registry that uses def for unregistered nodes.
+func NewRegistry(def Constructor) *Registry {
+	return &Registry{
+		Default:      def,
+		constructors: map[registryKey]Constructor{},
+	}
+}
+
+// Register registers c as the constructor for HTML elements named name. It
+// panics if name is empty, c is nil or name is already registered, so that
+// clashes between packages surface at init time rather than as a silently
+// shadowed component.
+func (r *Registry) Register(name string, c Constructor) {
+	r.RegisterNS("", name, c)
+}
+
+// RegisterNS is like Register, but for elements in the given namespace.
+func (r *Registry) RegisterNS(namespace, name string, c Constructor) {
+	if name == "" {
+		panic("nml: Register called with an empty name")
+	}
+	if c == nil {
+		panic("nml: Register called with a nil constructor for " + qualifiedName(namespace, name))
+	}
+	k := newRegistryKey(namespace, name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.constructors == nil {
+		r.constructors = map[registryKey]Constructor{}
+	}
+	if _, dup := r.constructors[k]; dup {
+		panic(fmt.Sprintf("nml: Register called twice for %s", qualifiedName(namespace, name)))
+	}
+	r.constructors[k] = c
+}
+
+// Registered reports whether a constructor is registered for the given
+// namespace and name.
+func (r *Registry) Registered(namespace, name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.constructors[newRegistryKey(namespace, name)]
+	return ok
+}
+
+// Lookup returns the Node for node: the registered constructor for element
+// nodes whose namespace and name match a registration, and Default otherwise.
+func (r *Registry) Lookup(node *NodeStruct) Node {
+	if node.Type == ElementNode {
+		node.registry = r
+		r.mu.RLock()
+		c, ok := r.constructors[newRegistryKey(node.Namespace, node.Data)]
+		r.mu.RUnlock()
+		if ok {
+			return c(node)
+		}
+	}
+	if r.Default != nil {
+		return r.Default(node)
+	}
+	return node
+}
+
+func newRegistryKey(namespace, name string) registryKey {
+	if namespace == "" {
+		// The tokenizer lower-cases HTML tag names.
+		name = strings.ToLower(name)
+	}
+	return registryKey{namespace, name}
+}
+
+func qualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return "<" + name + ">"
+	}
+	return "<" + namespace + " " + name + ">"
+}
@@ -0,0 +1,98 @@
+package nml
+
+import (
+	"strings"
+	"testing"
+)
+
+type testComponent struct {
+	*NodeStruct
+}
+
+type testDefault struct {
+	*NodeStruct
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry(func(node *NodeStruct) Node {
+		return &testDefault{NodeStruct: node}
+	})
+	r.Register("my-tag", func(node *NodeStruct) Node {
+		return &testComponent{NodeStruct: node}
+	})
+	return r
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := newTestRegistry()
+	if _, ok := r.Lookup(&NodeStruct{Type: ElementNode, Data: "my-tag"}).(*testComponent); !ok {
+		t.Errorf("<my-tag>: want *testComponent")
+	}
+	if _, ok := r.Lookup(&NodeStruct{Type: ElementNode, Data: "p"}).(*testDefault); !ok {
+		t.Errorf("<p>: want *testDefault")
+	}
+	if _, ok := r.Lookup(&NodeStruct{Type: TextNode, Data: "my-tag"}).(*testDefault); !ok {
+		t.Errorf("text node: want *testDefault")
+	}
+	if _, ok := r.Lookup(&NodeStruct{Type: ElementNode, Data: "my-tag", Namespace: "svg"}).(*testDefault); !ok {
+		t.Errorf("<svg my-tag>: want *testDefault")
+	}
+}
+
+func TestRegistryNamespace(t *testing.T) {
+	r := newTestRegistry()
+	r.RegisterNS("svg", "title", func(node *NodeStruct) Node {
+		return &testComponent{NodeStruct: node}
+	})
+	if _, ok := r.Lookup(&NodeStruct{Type: ElementNode, Data: "title", Namespace: "svg"}).(*testComponent); !ok {
+		t.Errorf("<svg title>: want *testComponent")
+	}
+	if _, ok := r.Lookup(&NodeStruct{Type: ElementNode, Data: "title"}).(*testDefault); !ok {
+		t.Errorf("<title>: want *testDefault")
+	}
+	if !r.Registered("svg", "title") || r.Registered("", "title") {
+		t.Errorf("Registered: got wrong namespaces for title")
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := newTestRegistry()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register: want panic for duplicate name")
+		}
+	}()
+	r.Register("MY-TAG", func(node *NodeStruct) Node {
+		return node
+	})
+}
+
+func TestRegistryParse(t *testing.T) {
+	r := newTestRegistry()
+	r.RegisterNS("svg", "my-tag", func(node *NodeStruct) Node {
+		return &testDefault{NodeStruct: node}
+	})
+	doc, err := Parse(nil, strings.NewReader(`<my-tag></my-tag><svg><my-tag></my-tag></svg>`), r.Lookup, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var html, svg int
+	var f func(Node)
+	f = func(n Node) {
+		if _, ok := n.(*testComponent); ok {
+			html++
+		}
+		if n.GetType() == ElementNode && n.GetNamespace() == "svg" && n.GetData() == "my-tag" {
+			if _, ok := n.(*testDefault); ok {
+				svg++
+			}
+		}
+		for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+			f(c)
+		}
+	}
+	f(doc)
+	if html != 1 || svg != 1 {
+		t.Errorf("got %d HTML and %d SVG components, want 1 and 1", html, svg)
+	}
+}
@@ -20,6 +20,10 @@ type writer interface {
 
 // Render renders the parse tree n to the given writer.
 //
+// If a node's PreRender or PostRender method fails, Render stops and returns
+// a *ComponentError holding the path of the failing node. Output already
+// written to w is not taken back.
+//
 // Rendering is done on a 'best effort' basis: calling Parse on the output of
 // Render will always result in something similar to the original tree, but it
 // is not necessarily an exact clone unless the original tree was 'well-formed'.
@@ -42,6 +46,9 @@ type writer interface {
 // text node would become a tree containing <html>, <head> and <body> elements.
 // Another example is that the programmatic equivalent of "a<head>b</head>c"
 // becomes "<html><head><head/><body>abc</body></html>".
+//
+// Render stops with an error wrapping the context's error if it reaches an
+// element whose Context has been cancelled.
 func Render(w io.Writer, n Node) error {
 	if x, ok := w.(writer); ok {
 		return render(x, n)
@@ -65,14 +72,46 @@ func render(w writer, n Node) error {
 	return err
 }
 
+// render1 renders n, calling its PreRender and PostRender methods around it.
+// Errors from those methods are returned as a *ComponentError.
 func render1(w writer, n Node) error {
-	n.Render()
+	if n.GetType() == ElementNode {
+		if err := checkContext(n); err != nil {
+			return err
+		}
+	}
+	if err := bindAttrs(n, true); err != nil {
+		return err
+	}
+	if r, ok := n.(PreRenderer); ok {
+		if err := r.PreRender(); err != nil {
+			return &ComponentError{Method: "PreRender", Path: Path(n), Span: n.GetSpan(), Err: err}
+		}
+	}
+	reflectAttrs(n)
+	err := renderNode(w, n)
+	if err != nil && err != plaintextAbort {
+		return err
+	}
+	if r, ok := n.(PostRenderer); ok {
+		if err := r.PostRender(); err != nil {
+			return &ComponentError{Method: "PostRender", Path: Path(n), Span: n.GetSpan(), Err: err}
+		}
+	}
+	return err
+}
+
+func renderNode(w writer, n Node) error {
 	// Render non-element nodes; these are the easy cases.
 	switch n.GetType() {
 	case ErrorNode:
 		return errors.New("html: cannot render an ErrorNode node")
 	case TextNode:
-		return escape(w, n.GetData())
+		s, err := interpolate(n, n.GetData(), "")
+		if err != nil {
+			return fmt.Errorf("nml: %s: %v", Path(n), err)
+		}
+		return escape(w, s)
 	case DocumentNode:
 		for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
 			if err := render1(w, c); err != nil {
@@ -81,7 +120,15 @@ func render1(w writer, n Node) error {
 		}
 		return nil
 	case ElementNode:
-		// No-op.
+		if _, ok := n.(builtin); ok {
+			// Built-in elements render only their content.
+			for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+				if err := render1(w, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 	case CommentNode:
 		if _, err := w.WriteString("<!--"); err != nil {
 			return err
@@ -147,6 +194,9 @@ func render1(w writer, n Node) error {
 		return err
 	}
 	for _, a := range n.GetAttr() {
+		if a.Namespace == "" && a.Key == rawAttr {
+			continue
+		}
 		if err := w.WriteByte(' '); err != nil {
 			return err
 		}
@@ -164,7 +214,11 @@ func render1(w writer, n Node) error {
 		if _, err := w.WriteString(`="`); err != nil {
 			return err
 		}
-		if err := escape(w, a.Val); err != nil {
+		val, err := interpolate(n, a.Val, attrContext(a.Key))
+		if err != nil {
+			return fmt.Errorf("nml: %s: attribute %s: %v", Path(n), a.Key, err)
+		}
+		if err := escape(w, val); err != nil {
 			return err
 		}
 		if err := w.WriteByte('"'); err != nil {
@@ -193,11 +247,20 @@ func render1(w writer, n Node) error {
 	}
 
 	// Render any child nodes.
+	rawText := categoryOf(n)&RawText != 0
 	switch n.GetData() {
 	case "iframe", "noembed", "noframes", "noscript", "plaintext", "script", "style", "xmp":
+		rawText = true
+	}
+	switch {
+	case rawText:
 		for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
 			if c.GetType() == TextNode {
-				if _, err := w.WriteString(c.GetData()); err != nil {
+				s, err := interpolate(c, c.GetData(), n.GetData())
+				if err != nil {
+					return fmt.Errorf("nml: %s: %v", Path(c), err)
+				}
+				if _, err := w.WriteString(s); err != nil {
 					return err
 				}
 			} else {
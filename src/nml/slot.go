@@ -0,0 +1,111 @@
+package nml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Project makes template the content of host, distributing the children host
+// had before into the <slot> elements of the template. It is meant to be
+// called from a component's Init method, when the children written by the
+// author of the page have been parsed and initialised:
+//
+//	func (n *MyCard) Init() error {
+//		template, err := nml.ParseFragmentBody(n.Context, strings.NewReader(card), Index)
+//		if err != nil {
+//			return err
+//		}
+//		return nml.Project(n, template)
+//	}
+//
+// A child with a slot="x" attribute goes into <slot name="x">, and every other
+// child goes into the default slot, the <slot> without a name. A slot that
+// receives nothing, or only whitespace, keeps its own children as default
+// content. The <slot> elements themselves are replaced by their content.
+//
+// It is an error for a child to name a slot that the template does not have,
+// or for there to be non-whitespace content for the default slot when the
+// template has none.
+func Project(host Node, template []Node) error {
+	slots := map[string]Node{}
+	for _, t := range template {
+		nodes := findAll(t, isSlot, false)
+		if isSlot(t) {
+			nodes = append([]Node{t}, nodes...)
+		}
+		for _, s := range nodes {
+			name, _ := attrValue(s, "name")
+			if _, dup := slots[name]; dup {
+				return fmt.Errorf("nml: %s: template has two slots named %q", elementName(host), name)
+			}
+			slots[name] = s
+		}
+	}
+
+	assigned := map[string][]Node{}
+	for c := host.GetFirstChild(); c != nil; c = host.GetFirstChild() {
+		RemoveChild(host, c)
+		name := ""
+		if c.GetType() == ElementNode {
+			name, _ = attrValue(c, "slot")
+		}
+		if _, ok := slots[name]; !ok {
+			if name != "" {
+				return fmt.Errorf("nml: %s: %s: no slot named %q", elementName(host), elementName(c), name)
+			}
+			if !isWhitespace(c) {
+				return fmt.Errorf("nml: %s: %s: template has no default slot", elementName(host), elementName(c))
+			}
+		}
+		assigned[name] = append(assigned[name], c)
+	}
+
+	// contentOf returns the nodes that replace slot.
+	contentOf := func(slot Node) []Node {
+		name, _ := attrValue(slot, "name")
+		content := assigned[name]
+		if allWhitespace(content) {
+			content = nil
+			for c := slot.GetFirstChild(); c != nil; c = slot.GetFirstChild() {
+				RemoveChild(slot, c)
+				content = append(content, c)
+			}
+		}
+		return content
+	}
+
+	var result []Node
+	for _, t := range template {
+		if isSlot(t) {
+			result = append(result, contentOf(t)...)
+			continue
+		}
+		for _, slot := range findAll(t, isSlot, false) {
+			parent := slot.GetParent()
+			for _, c := range contentOf(slot) {
+				InsertBefore(parent, c, slot)
+			}
+			RemoveChild(parent, slot)
+		}
+		result = append(result, t)
+	}
+	AppendChildren(host, result)
+	return nil
+}
+
+func isSlot(n Node) bool {
+	return n.GetType() == ElementNode && n.GetNamespace() == "" && n.GetData() == "slot"
+}
+
+func isWhitespace(n Node) bool {
+	return n.GetType() == CommentNode || n.GetType() == TextNode && strings.Trim(n.GetData(), whitespace) == ""
+}
+
+func allWhitespace(nodes []Node) bool {
+	for _, n := range nodes {
+		if !isWhitespace(n) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package nml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	testCases := []struct {
+		template, children, want string
+	}{
+		{
+			`<h2><slot name="title">Untitled</slot></h2><div><slot></slot></div>`,
+			`<b slot="title">Hi</b> <p>body</p>`,
+			`<h2><b slot="title">Hi</b></h2><div> <p>body</p></div>`,
+		},
+		{
+			`<h2><slot name="title">Untitled</slot></h2><div><slot><i>empty</i></slot></div>`,
+			"\n\t",
+			`<h2>Untitled</h2><div><i>empty</i></div>`,
+		},
+		{
+			`<slot></slot><hr/>`,
+			`a<b>b</b>`,
+			`a<b>b</b><hr/>`,
+		},
+	}
+	for _, tc := range testCases {
+		host := &NodeStruct{Type: ElementNode, Data: "x-host"}
+		children, err := ParseFragmentBody(nil, strings.NewReader(tc.children), testLookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AppendChildren(host, children)
+		template, err := ParseFragmentBody(nil, strings.NewReader(tc.template), testLookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Project(host, template); err != nil {
+			t.Errorf("%s: %v", tc.template, err)
+			continue
+		}
+		b := new(bytes.Buffer)
+		for c := host.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+			if err := Render(b, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tc.template, got, tc.want)
+		}
+	}
+}
+
+func TestProjectErrors(t *testing.T) {
+	testCases := []struct {
+		template, children, want string
+	}{
+		{
+			`<div><slot></slot></div>`,
+			`<b slot="title">Hi</b>`,
+			`nml: x-host: b: no slot named "title"`,
+		},
+		{
+			`<div><slot name="title"></slot></div>`,
+			`text`,
+			`nml: x-host: #text: template has no default slot`,
+		},
+		{
+			`<slot></slot><slot></slot>`,
+			``,
+			`nml: x-host: template has two slots named ""`,
+		},
+	}
+	for _, tc := range testCases {
+		host := &NodeStruct{Type: ElementNode, Data: "x-host"}
+		children, err := ParseFragmentBody(nil, strings.NewReader(tc.children), testLookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AppendChildren(host, children)
+		template, err := ParseFragmentBody(nil, strings.NewReader(tc.template), testLookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Project(host, template)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %s", tc.template, err, tc.want)
+		}
+	}
+}
+
+func testLookup(node *NodeStruct) Node {
+	return node
+}
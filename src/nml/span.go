@@ -0,0 +1,29 @@
+package nml
+
+// A Span is the part of a source document that a node was parsed from. An
+// element's span runs from the start of its start tag to the end of its end
+// tag, or, if it has none, to the start of whatever closed it. Elements the
+// parser implies, such as a missing <body>, have an empty span at the token
+// that implied them. Spans are only recorded when the parser is given the Spans
+// option.
+type Span struct {
+	// Source is the ID of the document, as given to the parser with
+	// SourceID. It is empty if the parser was not given one.
+	Source     string
+	Start, End Position
+}
+
+// IsZero reports whether s is the zero Span, which nodes that were not
+// parsed, or were parsed without spans, have.
+func (s Span) IsZero() bool {
+	return s == Span{}
+}
+
+// String returns the start of s as "source:line:column", or "line:column" if
+// s has no Source.
+func (s Span) String() string {
+	if s.Source == "" {
+		return s.Start.String()
+	}
+	return s.Source + ":" + s.Start.String()
+}
@@ -0,0 +1,72 @@
+package nml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpans(t *testing.T) {
+	src := "<div id=\"a\">\n  <p>one\n  <b>two</b>\n</div>end"
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(src), newBuiltinRegistry().Lookup, Spans(), SourceID("doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := map[string]string{}
+	var walk func(n Node)
+	walk = func(n Node) {
+		if s, path := n.GetSpan(), Path(n); spans[path] == "" {
+			spans[path] = s.String() + "-" + s.End.String()
+		}
+		for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	want := map[string]string{
+		"div#a":           "doc:1:1-4:7",
+		"div#a>#text":     "doc:1:13-2:3",
+		"div#a>p":         "doc:2:3-4:1",
+		"div#a>p>#text":   "doc:2:6-3:3",
+		"div#a>p>b":       "doc:3:3-3:13",
+		"div#a>p>b>#text": "doc:3:6-3:9",
+		"#text":           "doc:4:7-4:10",
+	}
+	for path, w := range want {
+		if got := spans[path]; got != w {
+			t.Errorf("%s: got span %s, want %s", path, got, w)
+		}
+	}
+	if got, want := nodes[0].GetSpan().End.Offset, len(src)-len("end"); got != want {
+		t.Errorf("got end offset %d, want %d", got, want)
+	}
+	if c := CloneTree(nodes[0], newBuiltinRegistry().Lookup); c.GetSpan() != nodes[0].GetSpan() {
+		t.Errorf("clone has span %v, want %v", c.GetSpan(), nodes[0].GetSpan())
+	}
+	nodes, err = ParseFragmentBody(nil, strings.NewReader(src), newBuiltinRegistry().Lookup, SourceID("doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := nodes[0].GetSpan(); !s.IsZero() {
+		t.Errorf("without Spans: got span %v, want none", s)
+	}
+}
+
+func TestImpliedSpans(t *testing.T) {
+	doc, err := Parse(nil, strings.NewReader("\n<p>x</p>"), newBuiltinRegistry().Lookup, nil, Spans())
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := doc.GetFirstChild()
+	body := html.GetLastChild()
+	if s := body.GetSpan(); s.Start.String() != "2:1" || s.End != doc.GetFirstChild().GetSpan().End {
+		t.Errorf("got <body> span %v-%v, want an implied span at 2:1 running to the end", s.Start, s.End)
+	}
+	if s := body.GetFirstChild().GetSpan(); s.String() != "2:1" || s.End.String() != "2:9" {
+		t.Errorf("got <p> span %v-%v, want 2:1-2:9", s.Start, s.End)
+	}
+	if !doc.GetSpan().IsZero() {
+		t.Errorf("got document span %v, want none", doc.GetSpan())
+	}
+}
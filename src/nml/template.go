@@ -0,0 +1,184 @@
+package nml
+
+import (
+	"fmt"
+	"io"
+	a "nml/atom"
+	"strings"
+)
+
+// Templated is implemented by components whose content comes from a
+// template. Template returns the ID of the template, which the Registry that
+// created the component opens with its Templates function. If the returned
+// reader is an io.Closer, it is closed once the template is parsed.
+//
+// The template is parsed once and cached by the Registry. Each instance of
+// the component gets its own copy, created with the Registry's Lookup so that
+// custom elements in the template work, and the children the page author
+// wrote are projected into the template's slots as described at Project.
+// This happens when the component is initialised, just before its fields are
+// bound and its Init method runs, so Init sees the finished content.
+type Templated interface {
+	Template() string
+}
+
+// instantiate replaces the content of n with a copy of the template id.
+func instantiate(n Node, id string) error {
+	r := n.base().registry
+	if r == nil {
+		return fmt.Errorf("nml: %s: template %q: component was not created by a Registry", elementName(n), id)
+	}
+	outer := n.base().templates
+	ids := append(outer[:len(outer):len(outer)], id)
+	for _, t := range outer {
+		if t == id {
+			return fmt.Errorf("nml: %s: template %q includes itself: %s", elementName(n), id, strings.Join(ids, " > "))
+		}
+	}
+	var template []Node
+	var err error
+	if ctx := n.GetContext(); ctx != nil && ctx.Templates != nil {
+		template, err = r.parse(ctx.Templates, id, false, nil)
+	} else {
+		template, err = r.template(id)
+	}
+	if err != nil {
+		return fmt.Errorf("nml: %s: template %q: %v", elementName(n), id, err)
+	}
+	clones := make([]Node, len(template))
+	for i, t := range template {
+		clones[i] = CloneTree(t, r.Lookup)
+		inherit(clones[i], n.base())
+		setTemplates(clones[i], ids)
+		// The copy is about to become part of n, which is being
+		// initialised, so its nodes must be ready before n's Init runs.
+		// PostInit follows when the walk that is initialising n reaches
+		// them.
+		if err := walkPostOrder(clones[i], initNode); err != nil {
+			return err
+		}
+	}
+	return Project(n, clones)
+}
+
+// setTemplates records in n and its descendants that they are copies of the
+// templates ids.
+func setTemplates(n Node, ids []string) {
+	n.base().templates = ids
+	for c := n.GetFirstChild(); c != nil; c = c.GetNextSibling() {
+		setTemplates(c, ids)
+	}
+}
+
+// template returns the parsed template with the given ID, parsing it on first
+// use. The cached nodes are plain NodeStructs that have not been initialised;
+// they are only ever cloned.
+func (r *Registry) template(id string) ([]Node, error) {
+	r.mu.RLock()
+	t, ok := r.templates[id]
+	r.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+	t, err := r.parse(r.Templates, id, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.keep(id, t)
+	return t, nil
+}
+
+// keep caches the parsed template id.
+func (r *Registry) keep(id string, t []Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.templates == nil {
+		r.templates = map[string][]Node{}
+	}
+	r.templates[id] = t
+}
+
+// parse opens the document id with open and parses it into plain
+// NodeStructs, as a whole page if page is set and otherwise as the content of
+// a <body>, as templates are. The custom elements in it are parsed as the
+// components they will become. If errs is not nil, the parse errors are
+// appended to it.
+func (r *Registry) parse(open func(id string) (io.Reader, error), id string, page bool, errs *[]ParseError) ([]Node, error) {
+	if open == nil {
+		return nil, fmt.Errorf("Registry has no Templates function")
+	}
+	src, err := open(id)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := src.(io.Closer); ok {
+		defer c.Close()
+	}
+	lookup := func(node *NodeStruct) Node {
+		return node
+	}
+	// Templates are parsed once, so they always get spans, which their
+	// copies keep.
+	opts := []ParseOption{Spans(), SourceID(id), classifyWith(r.Lookup)}
+	if r.Strict {
+		opts = append(opts, Strict())
+	}
+	if errs != nil {
+		opts = append(opts, CollectErrors(errs))
+	}
+	if page {
+		doc, err := parse(nil, src, lookup, nil, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return []Node{doc}, nil
+	}
+	return parseFragment(nil, src, &NodeStruct{Type: ElementNode, Data: "body", DataAtom: a.Body}, lookup, opts...)
+}
+
+// Forget drops the cached templates with the given IDs, so that they are
+// opened and parsed again the next time they are used. Components that were
+// already created from them keep their content.
+func (r *Registry) Forget(ids ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.templates, id)
+	}
+}
+
+// Preload parses and caches the templates with the given IDs now, rather than
+// when they are first used. It stops at the first template that cannot be
+// opened or has a parse error, even one the parser would recover from, so a
+// broken template can fail the startup of a server instead of a request.
+func (r *Registry) Preload(ids ...string) error {
+	for _, id := range ids {
+		var errs []ParseError
+		t, err := r.parse(r.Templates, id, false, &errs)
+		if err != nil {
+			return fmt.Errorf("nml: template %q: %v", id, err)
+		}
+		if len(errs) > 0 {
+			return &errs[0]
+		}
+		r.keep(id, t)
+	}
+	return nil
+}
+
+// CheckPages parses the pages with the given IDs, which are whole documents
+// rather than templates, opening them with r.Templates. It returns the first
+// page that cannot be opened or has a parse error, like Preload. The pages
+// are not kept, and their components are not initialised.
+func (r *Registry) CheckPages(ids ...string) error {
+	for _, id := range ids {
+		var errs []ParseError
+		if _, err := r.parse(r.Templates, id, true, &errs); err != nil {
+			return fmt.Errorf("nml: page %q: %v", id, err)
+		}
+		if len(errs) > 0 {
+			return &errs[0]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package nml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type templatedCard struct {
+	*NodeStruct
+	Title Node `nml:"h2"`
+}
+
+func (n *templatedCard) Template() string {
+	return "card"
+}
+
+type templatedBadge struct {
+	*NodeStruct
+}
+
+func (n *templatedBadge) Template() string {
+	return "badge"
+}
+
+func TestTemplated(t *testing.T) {
+	sources := map[string]string{
+		"card":  `<h2><slot name="title">Untitled</slot></h2><x-badge></x-badge><slot></slot>`,
+		"badge": `<b>*</b>`,
+	}
+	opened := map[string]int{}
+	r := NewRegistry(nil)
+	r.Templates = func(id string) (io.Reader, error) {
+		s, ok := sources[id]
+		if !ok {
+			return nil, fmt.Errorf("no such template")
+		}
+		opened[id]++
+		return strings.NewReader(s), nil
+	}
+	r.Register("x-card", func(node *NodeStruct) Node {
+		return &templatedCard{NodeStruct: node}
+	})
+	r.Register("x-badge", func(node *NodeStruct) Node {
+		return &templatedBadge{NodeStruct: node}
+	})
+
+	src := `<x-card><i slot="title">One</i>body</x-card><x-card></x-card>`
+	nodes, err := ParseFragmentBody(nil, strings.NewReader(src), r.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	for _, n := range nodes {
+		if err := Render(b, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `<x-card><h2><i slot="title">One</i></h2><x-badge><b>*</b></x-badge>body</x-card>` +
+		`<x-card><h2>Untitled</h2><x-badge><b>*</b></x-badge></x-card>`
+	if got := b.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if opened["card"] != 1 || opened["badge"] != 1 {
+		t.Errorf("templates opened %v times, want once each", opened)
+	}
+	c0, c1 := nodes[0].(*templatedCard), nodes[1].(*templatedCard)
+	if c0.Title == nil || c0.Title == c1.Title {
+		t.Errorf("Title: got %v and %v, want a separate <h2> per instance", c0.Title, c1.Title)
+	}
+
+	_, err = ParseFragmentBody(nil, strings.NewReader(`<x-card><x-card slot="nope"></x-card></x-card>`), r.Lookup)
+	if err == nil || !strings.Contains(err.Error(), `no slot named "nope"`) {
+		t.Errorf("got error %v, want a slot error", err)
+	}
+	delete(sources, "badge")
+	r.templates = nil
+	_, err = ParseFragmentBody(nil, strings.NewReader(`<x-badge></x-badge>`), r.Lookup)
+	if want := `nml: x-badge: template "badge": no such template`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestRecursiveTemplate(t *testing.T) {
+	sources := map[string]string{
+		"card":  `<h2>card</h2><x-badge></x-badge>`,
+		"badge": `<b><x-card></x-card></b>`,
+	}
+	r := NewRegistry(nil)
+	r.Templates = func(id string) (io.Reader, error) {
+		return strings.NewReader(sources[id]), nil
+	}
+	r.Register("x-card", func(node *NodeStruct) Node {
+		return &templatedCard{NodeStruct: node}
+	})
+	r.Register("x-badge", func(node *NodeStruct) Node {
+		return &templatedBadge{NodeStruct: node}
+	})
+	_, err := ParseFragmentBody(nil, strings.NewReader(`<x-card></x-card>`), r.Lookup)
+	if want := `nml: x-card: template "card" includes itself: card > badge > card`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	// The same component may appear in the content of another instance.
+	sources["badge"] = `<b><slot></slot></b>`
+	r.Forget("badge")
+	if _, err := ParseFragmentBody(nil, strings.NewReader(`<x-badge><x-badge></x-badge></x-badge>`), r.Lookup); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestContextTemplates(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Templates = func(id string) (io.Reader, error) {
+		return strings.NewReader(`<b>published</b>`), nil
+	}
+	r.Register("x-badge", func(node *NodeStruct) Node {
+		return &templatedBadge{NodeStruct: node}
+	})
+	ctx := Background()
+	ctx.Templates = func(id string) (io.Reader, error) {
+		return strings.NewReader(`<i>draft</i>`), nil
+	}
+	for _, tc := range []struct {
+		ctx  *Context
+		want string
+	}{
+		{ctx, `<x-badge><i>draft</i></x-badge>`},
+		{nil, `<x-badge><b>published</b></x-badge>`},
+	} {
+		nodes, err := ParseFragmentBody(tc.ctx, strings.NewReader(`<x-badge></x-badge>`), r.Lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := new(bytes.Buffer)
+		if err := Render(b, nodes[0]); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("got %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestForgetAndPreload(t *testing.T) {
+	src := map[string]string{"x": `<b>one</b>`}
+	r := NewRegistry(nil)
+	r.Templates = func(id string) (io.Reader, error) {
+		s, ok := src[id]
+		if !ok {
+			return nil, fmt.Errorf("no template")
+		}
+		return strings.NewReader(s), nil
+	}
+	if err := r.Preload("x"); err != nil {
+		t.Fatal(err)
+	}
+	src["x"] = `<i>two</i>`
+	if tpl, _ := r.template("x"); tpl[0].GetData() != "b" {
+		t.Errorf("got <%s>, want the cached <b>", tpl[0].GetData())
+	}
+	r.Forget("x")
+	if tpl, _ := r.template("x"); tpl[0].GetData() != "i" {
+		t.Errorf("got <%s> after Forget, want <i>", tpl[0].GetData())
+	}
+	if err := r.Preload("x", "y"); err == nil || err.Error() != `nml: template "y": no template` {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Templates = func(id string) (io.Reader, error) {
+		return strings.NewReader("<p>one\n<div>two</div>"), nil
+	}
+	r.Register("x-badge", func(node *NodeStruct) Node {
+		return &templatedBadge{NodeStruct: node}
+	})
+	if _, err := ParseFragmentBody(nil, strings.NewReader(`<x-badge></x-badge>`), r.Lookup); err != nil {
+		t.Fatal(err)
+	}
+	r.Forget("badge")
+	r.Strict = true
+	_, err := ParseFragmentBody(nil, strings.NewReader(`<x-badge></x-badge>`), r.Lookup)
+	if want := `nml: x-badge: template "badge": nml: badge:2:1: <p> is closed by <div> before its end tag`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
@@ -113,6 +113,40 @@ func (t Token) String() string {
 	return "Invalid(" + strconv.Itoa(int(t.Type)) + ")"
 }
 
+// A Position is a place in a Tokenizer's input. Offset counts bytes from the
+// start of the input; Line and Column count from 1, and Column counts runes,
+// not bytes.
+type Position struct {
+	Offset, Line, Column int
+}
+
+func (pos Position) String() string {
+	return strconv.Itoa(pos.Line) + ":" + strconv.Itoa(pos.Column)
+}
+
+// advance returns the position after the bytes b, which start at pos. "\r\n"
+// and a lone "\r" each count as one line break.
+func (pos Position) advance(b []byte) Position {
+	for i, c := range b {
+		switch {
+		case c == '\n':
+			if i > 0 && b[i-1] == '\r' {
+				break
+			}
+			pos.Line++
+			pos.Column = 1
+		case c == '\r':
+			pos.Line++
+			pos.Column = 1
+		case c&0xc0 != 0x80:
+			// Only the first byte of a UTF-8 sequence starts a new column.
+			pos.Column++
+		}
+	}
+	pos.Offset += len(b)
+	return pos
+}
+
 // span is a range of bytes in a Tokenizer's buffer. The start is inclusive,
 // the end is exclusive.
 type span struct {
@@ -142,6 +176,9 @@ type Tokenizer struct {
 	// buf[raw.end:] is buffered input that will yield future tokens.
 	raw span
 	buf []byte
+	// start and end are the positions in the input of the start of the
+	// current token and of the byte after it.
+	start, end Position
 	// buf[data.start:data.end] holds the raw bytes of the current token's data:
 	// a text token's text, a tag token's tag name, etc.
 	data span
@@ -935,9 +972,25 @@ func (z *Tokenizer) readTagAttrVal() {
 // Next scans the next token and returns its type.
 func (z *Tokenizer) Next() TokenType {
 	if z.err != nil {
+		z.start = z.end
 		z.tt = ErrorToken
 		return z.tt
 	}
+	z.start = z.end
+	z.next()
+	z.end = z.start.advance(z.buf[z.raw.start:z.raw.end])
+	return z.tt
+}
+
+// Span returns the positions in the input of the start of the current token
+// and of the byte after its end. After an ErrorToken, both are the position
+// of the end of the input.
+func (z *Tokenizer) Span() (start, end Position) {
+	return z.start, z.end
+}
+
+// next does the work of Next, without keeping track of positions.
+func (z *Tokenizer) next() TokenType {
 	z.raw.start = z.raw.end
 	z.data.start = z.raw.end
 	z.data.end = z.raw.end
@@ -1012,6 +1065,7 @@ loop:
 			if c == '>' {
 				// "</>" does not generate a token at all.
 				// Reset the tokenizer state and start again.
+				z.start = z.start.advance(z.buf[z.raw.start:z.raw.end])
 				z.raw.start = z.raw.end
 				z.data.start = z.raw.end
 				z.data.end = z.raw.end
@@ -1187,6 +1241,7 @@ func NewTokenizerFragment(r io.Reader, contextTag string) *Tokenizer {
 	z := &Tokenizer{
 		r:   r,
 		buf: make([]byte, 0, 4096),
+		end: Position{Line: 1, Column: 1},
 	}
 	if contextTag != "" {
 		switch s := strings.ToLower(contextTag); s {
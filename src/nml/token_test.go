@@ -667,3 +667,24 @@ func benchmarkTokenizer(b *testing.B, level int) {
 func BenchmarkRawLevelTokenizer(b *testing.B)  { benchmarkTokenizer(b, rawLevel) }
 func BenchmarkLowLevelTokenizer(b *testing.B)  { benchmarkTokenizer(b, lowLevel) }
 func BenchmarkHighLevelTokenizer(b *testing.B) { benchmarkTokenizer(b, highLevel) }
+
+func TestSpan(t *testing.T) {
+	src := "<p>\r\nh\u00e9llo</p>\n</>\n<!-- x\ny -->"
+	want := []string{"1:1-1:4", "1:4-2:6", "2:6-2:10", "2:10-3:1", "3:4-4:1", "4:1-5:6", "5:6-5:6"}
+	z := NewTokenizer(strings.NewReader(src))
+	var got []string
+	for {
+		tt := z.Next()
+		start, end := z.Span()
+		got = append(got, start.String()+"-"+end.String())
+		if tt == ErrorToken {
+			break
+		}
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+	if _, end := z.Span(); end.Offset != len(src) {
+		t.Errorf("got end offset %d, want %d", end.Offset, len(src))
+	}
+}
@@ -0,0 +1,16 @@
+//go:build appengine
+// +build appengine
+
+package root
+
+import (
+	"context"
+)
+
+func init() {
+	// On App Engine there is no main to choose the content. Elsewhere the
+	// command that serves the handler calls UseDir itself.
+	if err := useEnvDir(context.Background()); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,122 @@
+package root
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"nml"
+	"os"
+	"store"
+	"tags"
+)
+
+// Dev is true when the site runs in development mode, which is selected by
+// setting NYLON_MODE=development in the environment. It must be set before
+// UseDir is called.
+var Dev = os.Getenv("NYLON_MODE") == "development"
+
+// UseDir registers the documents in dir as the site's store. In development
+// they are read from disk on every request, and templates whose files change
+// are parsed again. Otherwise every document is loaded into memory and parsed
+// up front, pages as whole documents and templates as fragments, and the
+// first error is returned, even one the parser would recover from, so that a
+// broken page or template stops the server from starting rather than failing
+// requests later.
+func UseDir(ctx context.Context, dir string) error {
+	fs := store.NewFS(dir)
+	if Dev {
+		// Record the current mtimes, against which refresh compares.
+		if _, err := fs.Changed(ctx); err != nil {
+			return err
+		}
+		store.Register(fs)
+		return nil
+	}
+	m, err := store.Load(ctx, fs)
+	if err != nil {
+		return err
+	}
+	ids, err := m.List(ctx)
+	if err != nil {
+		return err
+	}
+	var pages, templates []string
+	for _, id := range ids {
+		if id == ErrorDoc || Routes.Renders(id) {
+			pages = append(pages, id)
+		} else {
+			templates = append(templates, id)
+		}
+	}
+	store.Register(m)
+	if err := tags.Registry.CheckPages(pages...); err != nil {
+		return err
+	}
+	return tags.Registry.Preload(templates...)
+}
+
+// useEnvDir calls UseDir with the directory named by NYLON_CONTENT, if it is
+// set, to serve its .nml and .html documents instead of the built-in demo
+// pages.
+func useEnvDir(ctx context.Context) error {
+	if dir := os.Getenv("NYLON_CONTENT"); dir != "" {
+		return UseDir(ctx, dir)
+	}
+	return nil
+}
+
+// refresh drops the parsed templates whose documents have changed, if the
+// active store can tell.
+func refresh(ctx context.Context) error {
+	w, ok := store.Active().(store.Watcher)
+	if !ok {
+		return nil
+	}
+	changed, err := w.Changed(ctx)
+	if err != nil {
+		return err
+	}
+	tags.Registry.Forget(changed...)
+	return nil
+}
+
+// PreviewToken, if not empty, lets editors see drafts. A request that carries
+// it, in a preview query parameter or an X-Preview-Token header, is served the
+// latest draft of each page and template instead of the published revision,
+// if the store keeps drafts. It is read from NYLON_PREVIEW_TOKEN.
+var PreviewToken = os.Getenv("NYLON_PREVIEW_TOKEN")
+
+// isPreview reports whether r carries the preview token.
+func isPreview(r *http.Request) bool {
+	if PreviewToken == "" {
+		return false
+	}
+	token := r.Header.Get("X-Preview-Token")
+	if token == "" {
+		token = r.URL.Query().Get("preview")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(PreviewToken)) == 1
+}
+
+// newContext returns the Context to parse a page for r with. In a preview, the
+// templates of the components are read from the drafts too, and parsed for
+// the request rather than taken from the Registry's shared cache.
+func newContext(r *http.Request) *nml.Context {
+	ctx := nml.NewContext(r)
+	if d, ok := store.Active().(store.Drafter); ok && isPreview(r) {
+		ctx.Templates = func(id string) (io.Reader, error) {
+			return d.GetDraft(r.Context(), id)
+		}
+	}
+	return ctx
+}
+
+// open opens the page id for r, which is its latest draft in a preview.
+func open(r *http.Request, id string) (io.ReadCloser, error) {
+	s := store.Active()
+	if d, ok := s.(store.Drafter); ok && isPreview(r) {
+		return d.GetDraft(r.Context(), id)
+	}
+	return s.Get(r.Context(), id)
+}
@@ -0,0 +1,98 @@
+package root
+
+import (
+	"bytes"
+	"common"
+	"context"
+	"errors"
+	"net/http"
+	"nml"
+	"store"
+	"strconv"
+)
+
+// ErrorDoc is the ID of the document rendered when serving a page fails. Its
+// data context has the Status and StatusText of the response, and in
+// development the Error message and the Component whose lifecycle method
+// failed, if any; in production those two are empty, so that the workings of
+// the site are not shown to visitors. If the document is missing or fails in
+// turn, a plain text error is sent instead.
+var ErrorDoc = "error"
+
+// fail responds to a request for the document id whose parse, initialisation
+// or render failed with err. status is the status the document was being
+// served with.
+//
+// A component can make the page a 404 by returning nml.ErrNotFound from Init,
+// or redirect the client by returning an *nml.RedirectError. A document that
+// is not in the store is a 404 too. Anything else is a 500, or a 503 if the
+// request ran out of time; if the client went away nothing is sent.
+func fail(w http.ResponseWriter, r *http.Request, logger common.Logger, id string, status int, err error) {
+	var redirect *nml.RedirectError
+	switch {
+	case errors.As(err, &redirect):
+		http.Redirect(w, r, redirect.URL, redirect.Code)
+		return
+	case errors.Is(err, nml.ErrNotFound), errors.Is(err, store.ErrNotFound):
+		if status == http.StatusNotFound {
+			// The not found page itself is missing or not found.
+			http.NotFound(w, r)
+			return
+		}
+		notFound(w, r, logger)
+		return
+	case errors.Is(err, context.Canceled):
+		logger.Info("request cancelled", "id", id)
+		return
+	}
+
+	status = http.StatusInternalServerError
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+	kv := []interface{}{"id", id, "status", status, "err", err}
+	component := ""
+	var ce *nml.ComponentError
+	if errors.As(err, &ce) {
+		component = ce.Method + " " + ce.Path
+		kv = append(kv, "component", component)
+	}
+	logger.Error("serving document failed", kv...)
+	renderError(w, r, logger, status, err, component)
+}
+
+// renderError sends the ErrorDoc with the given status.
+func renderError(w http.ResponseWriter, r *http.Request, logger common.Logger, status int, err error, component string) {
+	data := map[string]interface{}{
+		"Status":     strconv.Itoa(status),
+		"StatusText": http.StatusText(status),
+		"Error":      "",
+		"Component":  "",
+	}
+	if Dev {
+		data["Error"] = err.Error()
+		data["Component"] = component
+	}
+	b := new(bytes.Buffer)
+	var doc nml.Node
+	var derr error
+	if ErrorDoc != "" {
+		doc, derr = parse(r, logger, ErrorDoc, &page{path: r.URL.Path, data: data})
+		if derr == nil {
+			derr = nml.Render(b, doc)
+		}
+	}
+	if ErrorDoc == "" || derr != nil {
+		if derr != nil && !errors.Is(derr, store.ErrNotFound) {
+			logger.Error("rendering the error page failed", "id", ErrorDoc, "err", derr)
+		}
+		msg := http.StatusText(status)
+		if Dev {
+			msg += "\n\n" + err.Error()
+		}
+		http.Error(w, msg, status)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond(w, r, status, b.Bytes())
+}
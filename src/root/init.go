@@ -1,27 +1,159 @@
 package root
 
 import (
-	"store"
 	"net/http"
 	"nml"
-	"bufio"
+	"bytes"
+	"cache"
 	"tags"
 	"common"
+	"router"
+	"strings"
 )
 
+// Routes maps the URLs of the site to the store documents that render them.
+// The routes are added here rather than in init, so that they are there for
+// any init that loads content, which needs to know which documents are pages.
+var Routes = func() *router.Router {
+	rt := router.New()
+	rt.Handle("/", "root", "GET")
+	rt.Handle("/friends/{name}", "friend", "GET")
+	return rt
+}()
+
 func init() {
 	http.HandleFunc("/", handler)
 }
 
 func handler(w http.ResponseWriter, r *http.Request) {
 
-	logger := &common.Logger{r}
+	logger := common.RequestLogger(r)
+
+	if Dev {
+		if err := refresh(r.Context()); err != nil {
+			logger.Error("reloading templates failed", "err", err)
+		}
+	}
+
+	m, err := Routes.Match(r.Method, r.URL.Path)
+	if err != nil {
+		if e, ok := err.(*router.MethodNotAllowedError); ok {
+			w.Header().Set("Allow", strings.Join(e.Allow, ", "))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		notFound(w, r, logger)
+		return
+	}
+	serve(w, r, logger, m.Doc, m.Params, http.StatusOK)
+
+}
+
+// notFound renders the router's NotFound document with status 404, or a plain
+// 404 if there is none.
+func notFound(w http.ResponseWriter, r *http.Request, logger common.Logger) {
+	if Routes.NotFound == "" {
+		http.NotFound(w, r)
+		return
+	}
+	serve(w, r, logger, Routes.NotFound, nil, http.StatusNotFound)
+}
+
+// serve renders the document id with the given route parameters.
+func serve(w http.ResponseWriter, r *http.Request, logger common.Logger, id string, params map[string]string, status int) {
+
+	preview := isPreview(r)
+	pages := pageCache(r, status, preview)
+	if pages != nil {
+		if e, ok := pages.Get(r, r.URL.Path); ok {
+			pages.SetHeaders(w.Header(), e)
+			respond(w, r, status, e.Body)
+			return
+		}
+	}
 
-	reader := store.Get("root")
-	doc, err := nml.Parse(reader, tags.Index, logger); if err != nil { panic(err) }
-	buf := bufio.NewWriter(w)
+	doc, err := parse(r, logger, id, &page{path: r.URL.Path, params: params})
+	if err != nil {
+		fail(w, r, logger, id, status, err)
+		return
+	}
+	// The page is rendered in full before anything is sent, so that a
+	// failure halfway through can still become an error page.
+	buf := new(bytes.Buffer)
 	err = nml.Render(buf, doc)
-	buf.Flush()
+	if err != nil {
+		fail(w, r, logger, id, status, err)
+		return
+	}
+
+	policy := cache.PolicyOf(doc)
+	if preview {
+		policy.Uncacheable = true
+	}
+	policy.SetHeaders(w.Header())
+	if pages != nil {
+		pages.Put(r, r.URL.Path, policy, buf.Bytes())
+	}
+	respond(w, r, status, buf.Bytes())
 
 }
 
+// PageCache holds rendered pages, for as long as the policies of their
+// components allow. Set it to nil to render every request.
+var PageCache = cache.NewPages(cache.NewLRU(1000))
+
+// pageCache returns the cache to use for r, or nil if the response must not
+// come from or go into the cache: in development, where documents change
+// under it, for previews of drafts, and for anything but a successful GET.
+func pageCache(r *http.Request, status int, preview bool) *cache.Pages {
+	if Dev || preview || status != http.StatusOK || r.Method != "GET" && r.Method != "HEAD" {
+		return nil
+	}
+	return PageCache
+}
+
+// parse opens and parses the document id, with p as its document node.
+func parse(r *http.Request, logger common.Logger, id string, p *page) (nml.Node, error) {
+	reader, err := open(r, id)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	lookup := func(node *nml.NodeStruct) nml.Node {
+		if node.Type == nml.DocumentNode {
+			p.NodeStruct = node
+			return p
+		}
+		return tags.Index(node)
+	}
+	opts := []nml.ParseOption{nml.SourceID(id)}
+	if Dev {
+		// Spans say where in the page an error happened, which is
+		// only worth their cost while the page is being worked on.
+		opts = append(opts, nml.Spans())
+	}
+	return nml.Parse(newContext(r), reader, lookup, logger, opts...)
+}
+
+// page is the document node of a page. It gives the components on the page
+// the request path as Path and the route parameters as Params, so that
+// {{ Params.name }} in a page served for /friends/{name} is the name in the URL.
+// Error pages get more, see renderError.
+type page struct {
+	*nml.NodeStruct
+	path   string
+	params map[string]string
+	data   map[string]interface{}
+}
+
+func (p *page) DataContext() interface{} {
+	params := p.params
+	if params == nil {
+		params = map[string]string{}
+	}
+	data := map[string]interface{}{"Path": p.path, "Params": params}
+	for k, v := range p.data {
+		data[k] = v
+	}
+	return data
+}
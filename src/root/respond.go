@@ -0,0 +1,101 @@
+package root
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Gzip is whether responses are compressed for clients that accept gzip.
+// Bodies shorter than gzipMinSize are sent as they are, since compressing
+// them gains little.
+var Gzip = true
+
+const gzipMinSize = 512
+
+// respond sends body, a rendered HTML page, with the given status. It sets
+// Content-Type, Content-Length and an ETag derived from the content, answers
+// a matching If-None-Match with 304 Not Modified, and compresses the body if
+// Gzip is set and the client accepts it.
+func respond(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+
+	sum := sha256.Sum256(body)
+	etag := hex.EncodeToString(sum[:16])
+	encode := Gzip && len(body) >= gzipMinSize && acceptsGzip(r)
+	if Gzip {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if encode {
+		// The compressed body is a different representation, so it
+		// needs a different tag.
+		etag += "-gzip"
+	}
+	etag = `"` + etag + `"`
+	if status == http.StatusOK {
+		h.Set("ETag", etag)
+		if (r.Method == "GET" || r.Method == "HEAD") && etagMatch(r.Header.Get("If-None-Match"), etag) {
+			h.Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if encode {
+		b := new(bytes.Buffer)
+		gz := gzip.NewWriter(b)
+		gz.Write(body)
+		gz.Close()
+		body = b.Bytes()
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		w.Write(body)
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows gzip.
+// An explicit gzip entry decides, whatever * says.
+func acceptsGzip(r *http.Request) bool {
+	star := false
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if coding == "gzip" {
+			return q > 0
+		}
+		star = q > 0
+	}
+	return star
+}
+
+// etagMatch reports whether the If-None-Match header value list matches etag,
+// using the weak comparison that If-None-Match calls for.
+func etagMatch(list, etag string) bool {
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package root
+
+import (
+	"cache"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"nml"
+	"os"
+	"path/filepath"
+	"store"
+	"strconv"
+	"strings"
+	"tags"
+	"testing"
+)
+
+type testFail struct {
+	*nml.NodeStruct
+}
+
+func (n *testFail) Init() error {
+	switch v, _ := nml.Eval(n, "Params.what"); v {
+	case "missing":
+		return nml.ErrNotFound
+	case "moved":
+		return nml.Redirect("/elsewhere", http.StatusMovedPermanently)
+	}
+	return errors.New("database on fire")
+}
+
+func init() {
+	tags.Registry.Register("test-fail", func(node *nml.NodeStruct) nml.Node {
+		return &testFail{NodeStruct: node}
+	})
+	Routes.Handle("/test/{what}", "test", "GET")
+}
+
+func get(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestErrors(t *testing.T) {
+	defer store.Register(store.Active())
+	store.Register(store.NewMemory(map[string]string{
+		"test":  `<p><test-fail id="f"></test-fail></p>`,
+		"404":   `<h1>Nothing at {{ Path }}</h1>`,
+		"error": `<h1>{{ Status }}</h1><nyl-if test="Error"><pre>{{ Error }}</pre><i>{{ Component }}</i></nyl-if>`,
+	}))
+	defer func(dev bool) { Dev = dev }(Dev)
+
+	w := get("/test/missing")
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Nothing at /test/missing") {
+		t.Errorf("missing: got %d %q", w.Code, w.Body.String())
+	}
+	w = get("/test/moved")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/elsewhere" {
+		t.Errorf("moved: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	Dev = false
+	w = get("/test/broken")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "<h1>500</h1>") ||
+		strings.Contains(w.Body.String(), "fire") {
+		t.Errorf("broken in production: got %d %q", w.Code, w.Body.String())
+	}
+	Dev = true
+	w = get("/test/broken")
+	if body := w.Body.String(); w.Code != http.StatusInternalServerError ||
+		!strings.Contains(body, "database on fire") || !strings.Contains(body, "<i>Init html&gt;body&gt;p&gt;test-fail#f</i>") {
+		t.Errorf("broken in development: got %d %q", w.Code, body)
+	}
+}
+
+func TestUseDir(t *testing.T) {
+	defer store.Register(store.Active())
+	defer func(dev bool) { Dev = dev }(Dev)
+	Dev = false
+	testCases := []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			map[string]string{
+				"root":   `<html><body><my-card><p>Hello</p></my-card></body></html>`,
+				"card":   `<div class="card"><slot></slot></div>`,
+				"usedir": `<b>ok</b>`,
+			},
+			"",
+		},
+		{
+			map[string]string{
+				"root":   `<html><body><p>Hello</p></body></html>`,
+				"usedir": `<b><div>x</b></div>`,
+			},
+			"nml: usedir:1:10: </b> closes <b> across <div>",
+		},
+		{
+			map[string]string{
+				"root": `<html><body><table>Hello</table></body></html>`,
+			},
+			`nml: root:1:20: text "Hello" moved out of <table>`,
+		},
+	}
+	for _, tc := range testCases {
+		dir, err := ioutil.TempDir("", "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for id, src := range tc.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, id+".nml"), []byte(src), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = UseDir(context.Background(), dir)
+		tags.Registry.Forget("card", "usedir")
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%v: got error %v, want %q", tc.files, err, tc.err)
+		}
+	}
+}
+
+// TestEnvDir loads content as the App Engine app does, with whole pages that
+// must be parsed as documents rather than as templates.
+func TestEnvDir(t *testing.T) {
+	defer store.Register(store.Active())
+	defer func(dev bool) { Dev = dev }(Dev)
+	defer os.Setenv("NYLON_CONTENT", os.Getenv("NYLON_CONTENT"))
+	Dev = false
+	dir, err := ioutil.TempDir("", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"root":   "<html>\n<head></head>\n<body><h1>From the directory</h1></body>\n</html>\n",
+		"friend": "<html>\n<head></head>\n<body><h1>{{ Params.name }}</h1></body>\n</html>\n",
+	}
+	for id, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, id+".nml"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("NYLON_CONTENT", dir)
+	if err := useEnvDir(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if w := get("/"); !strings.Contains(w.Body.String(), "<h1>From the directory</h1>") {
+		t.Errorf("got %d %q, want the page from the directory", w.Code, w.Body.String())
+	}
+}
+
+func TestPreviewTemplate(t *testing.T) {
+	defer store.Register(store.Active())
+	defer func(c *cache.Pages) { PageCache = c }(PageCache)
+	defer func(token string) { PreviewToken = token }(PreviewToken)
+	defer tags.Registry.Forget("card")
+	PageCache = nil
+	PreviewToken = "secret"
+	ctx := context.Background()
+	v := store.NewVersioned()
+	v.Put(ctx, "root", strings.NewReader(`<my-card><p>body</p></my-card>`))
+	v.Put(ctx, "card", strings.NewReader(`<div class="card"><slot></slot></div>`))
+	v.Publish(ctx, "root", 1)
+	v.Publish(ctx, "card", 1)
+	v.Save(ctx, "card", strings.NewReader(`<div class="draft"><slot></slot></div>`))
+	store.Register(v)
+	tags.Registry.Forget("card")
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/", `<div class="card"><p>body</p></div>`},
+		{"/?preview=secret", `<div class="draft"><p>body</p></div>`},
+		{"/", `<div class="card"><p>body</p></div>`},
+	} {
+		if body := get(tc.path).Body.String(); !strings.Contains(body, tc.want) {
+			t.Errorf("%s: got %q, want it to contain %q", tc.path, body, tc.want)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	page := []byte("<p>" + strings.Repeat("hello ", 200) + "</p>")
+	serve := func(header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		respond(w, r, http.StatusOK, page)
+		return w
+	}
+
+	w := serve()
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != string(page) || etag == "" ||
+		w.Header().Get("Content-Type") != "text/html; charset=utf-8" ||
+		w.Header().Get("Content-Length") != strconv.Itoa(len(page)) {
+		t.Errorf("plain: got %d %v", w.Code, w.Header())
+	}
+
+	w = serve("If-None-Match", `"other", `+etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	w = serve("Accept-Encoding", "deflate, gzip;q=0.5")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") == etag {
+		t.Fatalf("gzip: got %v", w.Header())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(gz)
+	if string(b) != string(page) {
+		t.Errorf("gzip: got body %q", b)
+	}
+
+	for ae, want := range map[string]string{
+		"gzip;q=0":       "",
+		"*;q=0, gzip":    "gzip",
+		"gzip;q=0, *":    "",
+		"br, *":          "gzip",
+		"*;q=0, deflate": "",
+	} {
+		w = serve("Accept-Encoding", ae)
+		if got := w.Header().Get("Content-Encoding"); got != want {
+			t.Errorf("%s: got Content-Encoding %q, want %q", ae, got, want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package router maps the paths of requests to the IDs of the store documents
+// that render them.
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by Match when no route matches the path.
+var ErrNotFound = errors.New("router: no route")
+
+// MethodNotAllowedError is returned by Match when routes match the path but
+// none of them allows the method.
+type MethodNotAllowedError struct {
+	Method string
+	// Allow lists the methods the matching routes allow, for the Allow
+	// header of the response.
+	Allow []string
+}
+
+func (e *MethodNotAllowedError) Error() string {
+	return fmt.Sprintf("router: method %s not allowed, only %s", e.Method, strings.Join(e.Allow, ", "))
+}
+
+// A Router holds routes, which are tried in the order they were added. The
+// zero value has no routes.
+type Router struct {
+	// NotFound is the ID of the document to render, with status 404, for
+	// paths that no route matches.
+	NotFound string
+
+	routes []*route
+}
+
+// New returns a Router with no routes that renders the document "404" for
+// unmatched paths.
+func New() *Router {
+	return &Router{NotFound: "404"}
+}
+
+// A Match is the result of routing a request.
+type Match struct {
+	// Pattern is the pattern of the route that matched.
+	Pattern string
+	// Doc is the ID of the document to render, with the parameters
+	// substituted.
+	Doc string
+	// Params holds the values of the parameters in the pattern.
+	Params map[string]string
+}
+
+type route struct {
+	pattern  string
+	segments []segment
+	doc      string
+	methods  []string
+	// docs matches the IDs of the documents the route renders.
+	docs *regexp.Regexp
+}
+
+// A segment of a pattern is a literal, or a parameter if param is set.
+type segment struct {
+	literal string
+	param   string
+	rest    bool // {name...}
+}
+
+// Handle adds a route from pattern to the document doc. A pattern is a path
+// whose segments are literals or parameters: {name} matches any one segment,
+// and a final {name...} matches the rest of the path, one or more segments.
+// The parameters are available to doc, which may use them itself, as in
+//
+//	rt.Handle("/blog/{slug}", "blog/{slug}", "GET")
+//
+// If methods are given, the route only matches requests with those methods;
+// GET also allows HEAD. Handle panics if pattern is malformed or doc uses a
+// parameter that pattern does not have.
+func (rt *Router) Handle(pattern, doc string, methods ...string) {
+	r, err := compile(pattern, doc, methods)
+	if err != nil {
+		panic(err)
+	}
+	rt.routes = append(rt.routes, r)
+}
+
+func compile(pattern, doc string, methods []string) (*route, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("router: pattern %q does not start with /", pattern)
+	}
+	r := &route{pattern: pattern, doc: doc}
+	params := map[string]bool{}
+	parts := strings.Split(pattern[1:], "/")
+	for i, p := range parts {
+		if !strings.HasPrefix(p, "{") {
+			if strings.ContainsAny(p, "{}") {
+				return nil, fmt.Errorf("router: pattern %q: bad segment %q", pattern, p)
+			}
+			r.segments = append(r.segments, segment{literal: p})
+			continue
+		}
+		if !strings.HasSuffix(p, "}") {
+			return nil, fmt.Errorf("router: pattern %q: bad segment %q", pattern, p)
+		}
+		s := segment{param: p[1 : len(p)-1]}
+		if strings.HasSuffix(s.param, "...") {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("router: pattern %q: %s is not the last segment", pattern, p)
+			}
+			s.param, s.rest = strings.TrimSuffix(s.param, "..."), true
+		}
+		if s.param == "" || strings.ContainsAny(s.param, "{}/") {
+			return nil, fmt.Errorf("router: pattern %q: bad segment %q", pattern, p)
+		}
+		if params[s.param] {
+			return nil, fmt.Errorf("router: pattern %q: duplicate parameter %s", pattern, s.param)
+		}
+		params[s.param] = true
+		r.segments = append(r.segments, s)
+	}
+	for _, name := range docParams(doc) {
+		if !params[name] {
+			return nil, fmt.Errorf("router: document %q uses {%s}, which pattern %q does not have", doc, name, pattern)
+		}
+	}
+	r.docs = regexp.MustCompile("^" + docRegexp(doc, r.segments) + "$")
+	for _, m := range methods {
+		m = strings.ToUpper(m)
+		r.methods = append(r.methods, m)
+		if m == http.MethodGet {
+			r.methods = append(r.methods, http.MethodHead)
+		}
+	}
+	return r, nil
+}
+
+// docParams returns the names of the parameters that doc uses.
+func docParams(doc string) []string {
+	var names []string
+	for {
+		i := strings.Index(doc, "{")
+		if i < 0 {
+			return names
+		}
+		j := strings.Index(doc[i:], "}")
+		if j < 0 {
+			return names
+		}
+		names = append(names, doc[i+1:i+j])
+		doc = doc[i+j+1:]
+	}
+}
+
+// docRegexp returns a regular expression for the IDs that doc becomes, where
+// each parameter matches what its segment can.
+func docRegexp(doc string, segments []segment) string {
+	re := ""
+	for {
+		i := strings.Index(doc, "{")
+		j := strings.Index(doc[i+1:], "}")
+		if i < 0 || j < 0 {
+			return re + regexp.QuoteMeta(doc)
+		}
+		param := "[^/]+"
+		for _, s := range segments {
+			if s.rest && s.param == doc[i+1:i+1+j] {
+				param = ".+"
+			}
+		}
+		re += regexp.QuoteMeta(doc[:i]) + param
+		doc = doc[i+1+j+1:]
+	}
+}
+
+// expand returns doc with each parameter replaced by its value. It makes one
+// pass over doc, so a value that looks like a parameter is left alone.
+func expand(doc string, params map[string]string) string {
+	b := new(strings.Builder)
+	for {
+		i := strings.Index(doc, "{")
+		j := strings.Index(doc[i+1:], "}")
+		if i < 0 || j < 0 {
+			b.WriteString(doc)
+			return b.String()
+		}
+		b.WriteString(doc[:i])
+		b.WriteString(params[doc[i+1:i+1+j]])
+		doc = doc[i+1+j+1:]
+	}
+}
+
+// Renders reports whether id is a document that the router renders: its
+// NotFound document, or the document of one of its routes for some values of
+// the parameters. Documents that it does not render, such as templates, are
+// only used by others.
+func (rt *Router) Renders(id string) bool {
+	if id == rt.NotFound {
+		return true
+	}
+	for _, r := range rt.routes {
+		if r.docs.MatchString(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the first route that matches the method and path. If none
+// matches the path it returns ErrNotFound, and if some match the path but not
+// the method it returns a *MethodNotAllowedError.
+func (rt *Router) Match(method, path string) (*Match, error) {
+	var allow []string
+	for _, r := range rt.routes {
+		params, ok := r.match(path)
+		if !ok {
+			continue
+		}
+		if !r.allows(method) {
+			allow = append(allow, r.methods...)
+			continue
+		}
+		return &Match{Pattern: r.pattern, Doc: expand(r.doc, params), Params: params}, nil
+	}
+	if allow != nil {
+		return nil, &MethodNotAllowedError{Method: method, Allow: dedupe(allow)}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *route) match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	parts := strings.Split(path[1:], "/")
+	params := map[string]string{}
+	for i, s := range r.segments {
+		if i >= len(parts) {
+			return nil, false
+		}
+		if s.param == "" {
+			if parts[i] != s.literal {
+				return nil, false
+			}
+			continue
+		}
+		value := parts[i]
+		if s.rest {
+			value = strings.Join(parts[i:], "/")
+			parts = parts[:i+1]
+		}
+		// Parameters may end up in document IDs, so they must not
+		// climb out of the directory they are used in.
+		for _, p := range strings.Split(value, "/") {
+			if p == "" || p == "." || p == ".." {
+				return nil, false
+			}
+		}
+		params[s.param] = value
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+func (r *route) allows(method string) bool {
+	if len(r.methods) == 0 {
+		return true
+	}
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupe(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, x := range s {
+		if i == 0 || x != s[i-1] {
+			out = append(out, x)
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	rt := New()
+	rt.Handle("/", "root", "GET")
+	rt.Handle("/blog/{slug}", "blog/{slug}", "GET")
+	rt.Handle("/blog/{slug}/edit", "edit", "POST")
+	rt.Handle("/docs/{path...}", "docs/{path}")
+	rt.Handle("/users/{id}", "user")
+	rt.Handle("/pair/{a}/{b}", "pair/{a}/{b}")
+
+	testCases := []struct {
+		method, path string
+		doc          string
+		params       map[string]string
+		err          string
+	}{
+		{"GET", "/", "root", map[string]string{}, ""},
+		{"HEAD", "/", "root", map[string]string{}, ""},
+		{"GET", "/blog/first", "blog/first", map[string]string{"slug": "first"}, ""},
+		{"POST", "/blog/first/edit", "edit", map[string]string{"slug": "first"}, ""},
+		{"DELETE", "/docs/a/b", "docs/a/b", map[string]string{"path": "a/b"}, ""},
+		{"GET", "/users/7", "user", map[string]string{"id": "7"}, ""},
+		{"GET", "/pair/{b}/x", "pair/{b}/x", map[string]string{"a": "{b}", "b": "x"}, ""},
+		{"GET", "/blog/first/edit", "", nil, "router: method GET not allowed, only POST"},
+		{"POST", "/blog/first", "", nil, "router: method POST not allowed, only GET, HEAD"},
+		{"GET", "/blog", "", nil, "router: no route"},
+		{"GET", "/blog/", "", nil, "router: no route"},
+		{"GET", "/blog/..", "", nil, "router: no route"},
+		{"GET", "/docs/a/../../x", "", nil, "router: no route"},
+		{"GET", "/docs", "", nil, "router: no route"},
+		{"GET", "/users/7/x", "", nil, "router: no route"},
+	}
+	for _, tc := range testCases {
+		m, err := rt.Match(tc.method, tc.path)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s %s: got error %v, want %s", tc.method, tc.path, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", tc.method, tc.path, err)
+			continue
+		}
+		if m.Doc != tc.doc || !reflect.DeepEqual(m.Params, tc.params) {
+			t.Errorf("%s %s: got %s %v, want %s %v", tc.method, tc.path, m.Doc, m.Params, tc.doc, tc.params)
+		}
+	}
+}
+
+func TestHandlePanics(t *testing.T) {
+	for _, tc := range [][2]string{
+		{"blog", "x"},
+		{"/blog/{", "x"},
+		{"/blog/a{b}", "x"},
+		{"/{a...}/b", "x"},
+		{"/{a}/{a}", "x"},
+		{"/blog/{slug}", "blog/{id}"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle(%q, %q) did not panic", tc[0], tc[1])
+				}
+			}()
+			New().Handle(tc[0], tc[1])
+		}()
+	}
+}
+
+func TestRenders(t *testing.T) {
+	rt := New()
+	rt.Handle("/", "root", "GET")
+	rt.Handle("/blog/{slug}", "blog/{slug}.v1", "GET")
+	rt.Handle("/docs/{path...}", "docs/{path}")
+	for id, want := range map[string]bool{
+		"root":        true,
+		"404":         true,
+		"blog/a.v1":   true,
+		"blog/a/b.v1": false,
+		"blog/a-v1":   false,
+		"docs/a/b":    true,
+		"docs/":       false,
+		"card":        false,
+		"blog/{slug}": false,
+	} {
+		if got := rt.Renders(id); got != want {
+			t.Errorf("Renders(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"io"
+	"nml"
+	"nml/atom"
+	"strings"
+)
+
+// DiffOp says what happened to a line between two revisions.
+type DiffOp int
+
+const (
+	Equal DiffOp = iota
+	Insert
+	Delete
+)
+
+// A DiffLine is one line of a diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// Diff returns the lines of a and b as a shortest edit from a to b, found from
+// their longest common subsequence. Within each run of changes, deletions come
+// before insertions.
+func Diff(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+	// lcs[i][j] is the length of the longest common subsequence of
+	// x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var d []DiffLine
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			d = append(d, DiffLine{Equal, x[i]})
+			i++
+			j++
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			d = append(d, DiffLine{Delete, x[i]})
+			i++
+		default:
+			d = append(d, DiffLine{Insert, y[j]})
+			j++
+		}
+	}
+	return d
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// RenderDiff writes d as HTML: a <pre class="diff"> holding each deleted line
+// in a <del>, each inserted line in an <ins> and the other lines as plain
+// text. The markup of the revisions is escaped, so that it shows as source.
+func RenderDiff(w io.Writer, d []DiffLine) error {
+	pre := &nml.NodeStruct{
+		Type:     nml.ElementNode,
+		Data:     "pre",
+		DataAtom: atom.Pre,
+		// nyl-raw keeps any {{ in the revisions from being
+		// interpolated.
+		Attr: []nml.Attribute{{Key: "class", Val: "diff"}, {Key: "nyl-raw"}},
+	}
+	for _, l := range d {
+		text := &nml.NodeStruct{Type: nml.TextNode, Data: l.Text}
+		var n nml.Node = text
+		switch l.Op {
+		case Insert:
+			n = &nml.NodeStruct{Type: nml.ElementNode, Data: "ins", DataAtom: atom.Ins}
+			nml.AppendChild(n, text)
+		case Delete:
+			n = &nml.NodeStruct{Type: nml.ElementNode, Data: "del", DataAtom: atom.Del}
+			nml.AppendChild(n, text)
+		}
+		nml.AppendChild(pre, n)
+	}
+	return nml.Render(w, pre)
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FS is a Store that reads documents from a directory tree. The document with
+// ID "blog/first-post" is the file blog/first-post.nml under Root, or
+// blog/first-post.html if there is no .nml file.
+type FS struct {
+	// Root is the directory that holds the documents.
+	Root string
+
+	// Exts are the file extensions that are tried, in order, when looking
+	// for a document. Put creates new documents with the first. If empty,
+	// ".nml" and ".html" are used.
+	Exts []string
+
+	mu   sync.Mutex
+	seen map[string]stamp // the stamps at the last call to Changed
+}
+
+// NewFS returns an FS that reads documents from the directory root.
+func NewFS(root string) *FS {
+	return &FS{Root: root}
+}
+
+func (s *FS) exts() []string {
+	if len(s.Exts) == 0 {
+		return []string{".nml", ".html"}
+	}
+	return s.Exts
+}
+
+// find returns the name of the file that holds the document id.
+func (s *FS) find(id string) (string, error) {
+	if checkID(id) != nil {
+		return "", &NotFoundError{ID: id}
+	}
+	base := filepath.Join(s.Root, filepath.FromSlash(id))
+	for _, ext := range s.exts() {
+		fi, err := os.Stat(base + ext)
+		if err == nil && fi.Mode().IsRegular() {
+			return base + ext, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", &NotFoundError{ID: id}
+}
+
+func (s *FS) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	name, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(name)
+}
+
+func (s *FS) List(ctx context.Context) ([]string, error) {
+	exts := s.exts()
+	seen := map[string]bool{}
+	err := filepath.Walk(s.Root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		for _, ext := range exts {
+			if strings.HasSuffix(name, ext) {
+				rel, err := filepath.Rel(s.Root, strings.TrimSuffix(name, ext))
+				if err != nil {
+					return err
+				}
+				seen[filepath.ToSlash(rel)] = true
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Put writes the document to the file that already holds it, or to a new file
+// with the first of Exts. The new content is written to a temporary file that
+// is renamed into place, so readers never see a partial document.
+func (s *FS) Put(ctx context.Context, id string, r io.Reader) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := s.find(id)
+	if _, ok := err.(*NotFoundError); ok {
+		name = filepath.Join(s.Root, filepath.FromSlash(id)) + s.exts()[0]
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), ".put-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *FS) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// Memory is a Store that keeps its documents in memory.
+type Memory struct {
+	mu   sync.RWMutex
+	docs map[string][]byte
+}
+
+// NewMemory returns a Memory holding docs, which maps IDs to sources.
+func NewMemory(docs map[string]string) *Memory {
+	m := &Memory{docs: map[string][]byte{}}
+	for id, s := range docs {
+		m.docs[id] = []byte(s)
+	}
+	return m
+}
+
+func (m *Memory) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	b, ok := m.docs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, &NotFoundError{ID: id}
+	}
+	// Put replaces the slice rather than writing to it, so b can be
+	// shared with the reader.
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *Memory) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.docs))
+	for id := range m.docs {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *Memory) Put(ctx context.Context, id string, r io.Reader) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.docs == nil {
+		m.docs = map[string][]byte{}
+	}
+	m.docs[id] = b
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.docs[id]; !ok {
+		return &NotFoundError{ID: id}
+	}
+	delete(m.docs, id)
+	return nil
+}
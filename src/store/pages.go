@@ -0,0 +1,61 @@
+package store
+
+// Default is the store that is active until Register is called. It holds the
+// pages of the demo site.
+var Default = NewMemory(map[string]string{
+	"root": `
+<html>
+	<head></head>
+	<body>
+		<h1>Hello world</h1>
+		<my-tag id="Root">
+			<p>Here's a normal paragraph</p>
+			<my-bio id="Me"/>
+			<ul>
+				<nyl-for each="Friends" as="friend"><li><a href="/friends/{{ friend }}">{{ friend }}</a></li></nyl-for>
+			</ul>
+			<p>Here's another paragraph</p>
+		</my-tag>
+		<my-card>
+			<span slot="title">A card</span>
+			<p>Whatever is inside the card goes into its body.</p>
+		</my-card>
+	</body>
+</html>
+`,
+	"friend": `
+<html>
+	<head></head>
+	<body>
+		<my-friend>
+			<h1>{{ Name }}</h1>
+			<p>{{ Name }} is a friend of mine.</p>
+		</my-friend>
+	</body>
+</html>
+`,
+	"404": `
+<html>
+	<head></head>
+	<body>
+		<h1>Not found</h1>
+		<p>There is nothing at {{ Path }}.</p>
+	</body>
+</html>
+`,
+	"error": `
+<html>
+	<head></head>
+	<body>
+		<h1>{{ Status }} {{ StatusText }}</h1>
+		<p>Something went wrong while we were putting this page together.</p>
+		<nyl-if test="Error">
+			<pre>{{ Error }}</pre>
+			<nyl-if test="Component"><p>In {{ Component }}.</p></nyl-if>
+		</nyl-if>
+	</body>
+</html>
+`,
+	"bio":  `<span style="color:{{ Color }};">This is my bio!</span><slot><span>Here's a second span</span></slot>`,
+	"card": `<div class="card"><h2><slot name="title">Untitled</slot></h2><div class="card-body"><slot></slot></div></div>`,
+})
@@ -1,26 +1,84 @@
+// Package store holds the documents and templates of the site. They are read
+// through a Store, so the same code can serve them from memory, from a
+// directory of files or from anything else that implements the interface.
 package store
 
-import "strings"
-
-func Get(id string) *strings.Reader {
-	s := ""
-	switch id {
-	case "root":
-		s = `
-<html>
-	<head></head>
-	<body>
-		<h1>Hello world</h1>
-		<my-tag id="Root">
-			<p>Here's a normal paragraph</p>
-			<my-bio id="Me"></my-bio>
-			<p>Here's another paragraph</p>
-		</my-tag>
-	</body>
-</html>
-`
-	case "bio":
-		s = `<span>This is my bio!</span><span>Here's a second span</span>`
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+// A Store holds documents by ID. IDs are slash separated paths, such as
+// "root" or "blog/first-post". A Store must be safe for concurrent use.
+type Store interface {
+	// Get opens the document with the given ID. The caller must close it.
+	Get(ctx context.Context, id string) (io.ReadCloser, error)
+	// List returns the IDs of all documents, sorted.
+	List(ctx context.Context) ([]string, error)
+	// Put creates or replaces the document with the given ID.
+	Put(ctx context.Context, id string, r io.Reader) error
+	// Delete removes the document with the given ID.
+	Delete(ctx context.Context, id string) error
+}
+
+// ErrNotFound is the error, possibly wrapped in a *NotFoundError, that Get and
+// Delete return for an ID that the Store does not hold. Test for it with
+// errors.Is.
+var ErrNotFound = errors.New("store: not found")
+
+// NotFoundError records the ID, and for a Versioned store the revision, that
+// was not found.
+type NotFoundError struct {
+	ID  string
+	Rev int
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Rev != 0 {
+		return fmt.Sprintf("store: %q revision %d not found", e.ID, e.Rev)
 	}
-	return strings.NewReader(s)
+	return fmt.Sprintf("store: %q not found", e.ID)
+}
+
+// Is makes errors.Is(err, ErrNotFound) true for a *NotFoundError.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// checkID reports an error if id is not a clean relative slash separated path,
+// so that it cannot name a file outside the root.
+func checkID(id string) error {
+	if id == "" || id != path.Clean(id) || path.IsAbs(id) || id == ".." ||
+		strings.HasPrefix(id, "../") || strings.ContainsRune(id, '\\') {
+		return fmt.Errorf("store: invalid id %q", id)
+	}
+	return nil
+}
+
+var (
+	mu     sync.RWMutex
+	active Store = Default
+)
+
+// Register makes s the store that the site's handlers and templates read
+// from. It is meant to be called once, before serving starts.
+func Register(s Store) {
+	if s == nil {
+		panic("store: Register called with a nil Store")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	active = s
+}
+
+// Active returns the Store passed to Register, or Default if there was none.
+func Active() Store {
+	mu.RLock()
+	defer mu.RUnlock()
+	return active
 }
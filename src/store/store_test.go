@@ -0,0 +1,251 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	if err := s.Put(ctx, "root", strings.NewReader("<p>root</p>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "blog/first", strings.NewReader("<p>first</p>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "root", strings.NewReader("<p>new root</p>")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Get(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "<p>new root</p>" {
+		t.Errorf("got %q, want %q", b, "<p>new root</p>")
+	}
+	ids, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"blog/first", "root"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got ids %q, want %q", ids, want)
+	}
+	if err := s.Delete(ctx, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "root"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got error %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "root"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete: got error %v, want ErrNotFound", err)
+	}
+	for _, id := range []string{"", "../x", "/x", "a/../b", `a\b`} {
+		if err := s.Put(ctx, id, strings.NewReader("x")); err == nil {
+			t.Errorf("Put %q: got no error", id)
+		}
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Get(cancelled, "blog/first"); err != context.Canceled {
+		t.Errorf("Get with a cancelled context: got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory(nil))
+}
+
+func TestFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testStore(t, NewFS(dir))
+
+	// Existing .html files are found and kept.
+	if err := ioutil.WriteFile(filepath.Join(dir, "about.html"), []byte("<p>about</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewFS(dir)
+	if err := s.Put(context.Background(), "about", strings.NewReader("<p>about us</p>")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "about.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "<p>about us</p>" {
+		t.Errorf("got %q in about.html, want %q", b, "<p>about us</p>")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "about.nml")); !os.IsNotExist(err) {
+		t.Errorf("Put created about.nml alongside about.html")
+	}
+}
+
+func TestFSChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	s := NewFS(dir)
+	if err := s.Put(ctx, "a", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "b", strings.NewReader("b")); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := s.Changed(ctx); err != nil || ids != nil {
+		t.Fatalf("first Changed: got %q, %v", ids, err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.nml"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "c.html"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := s.Changed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got changed %q, want %q", ids, want)
+	}
+	if ids, _ := s.Changed(ctx); ids != nil {
+		t.Errorf("got changed %q with no changes", ids)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemory(map[string]string{"a": "x", "b/c": "y"})
+	m, err := Load(ctx, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Put(ctx, "a", strings.NewReader("changed"))
+	r, err := m.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "x" {
+		t.Errorf("got %q, want the loaded %q", b, "x")
+	}
+	if ids, _ := m.List(ctx); !reflect.DeepEqual(ids, []string{"a", "b/c"}) {
+		t.Errorf("got ids %q", ids)
+	}
+}
+
+func TestVersioned(t *testing.T) {
+	ctx := context.Background()
+	read := func(r io.ReadCloser, err error) string {
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	v := NewVersioned()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	v.now = func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}
+	v.Put(ctx, "root", strings.NewReader("one"))
+	if _, err := v.Get(ctx, "root"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unpublished document: got error %v, want ErrNotFound", err)
+	}
+	if err := v.Publish(ctx, "root", 1); err != nil {
+		t.Fatal(err)
+	}
+	if rev, _ := v.Save(ctx, "root", strings.NewReader("two")); rev != 2 {
+		t.Errorf("Save: got revision %d, want 2", rev)
+	}
+	if got := read(v.Get(ctx, "root")); got != "one" {
+		t.Errorf("Get: got %q, want the published %q", got, "one")
+	}
+	if got := read(v.GetDraft(ctx, "root")); got != "two" {
+		t.Errorf("GetDraft: got %q, want %q", got, "two")
+	}
+	v.Publish(ctx, "root", 2)
+	rev, err := v.Rollback(ctx, "root", 1)
+	if err != nil || rev != 3 {
+		t.Fatalf("Rollback: got %d, %v", rev, err)
+	}
+	if got := read(v.Get(ctx, "root")); got != "one" {
+		t.Errorf("Get after Rollback: got %q, want %q", got, "one")
+	}
+	if got := read(v.GetRevision(ctx, "root", 2)); got != "two" {
+		t.Errorf("GetRevision 2: got %q, want %q", got, "two")
+	}
+	revs, _ := v.Revisions(ctx, "root")
+	var states []State
+	for i, r := range revs {
+		states = append(states, r.State)
+		if want := start.Add(time.Duration(i+1) * time.Hour); !r.Created.Equal(want) {
+			t.Errorf("revision %d: got Created %v, want %v", r.Rev, r.Created, want)
+		}
+	}
+	if want := []State{Archived, Archived, Published}; !reflect.DeepEqual(states, want) {
+		t.Errorf("got states %v, want %v", states, want)
+	}
+	if _, err := v.GetRevision(ctx, "root", 4); err == nil || err.Error() != `store: "root" revision 4 not found` {
+		t.Errorf("GetRevision 4: got error %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	v := NewVersioned()
+	v.Put(ctx, "bio", strings.NewReader("<p>a</p>\n<p>{{ Name }}</p>\n<p>c</p>\n"))
+	v.Put(ctx, "bio", strings.NewReader("<p>a</p>\n<p>B</p>\n<p>c</p>\n<p>d</p>\n"))
+	d, err := v.Diff(ctx, "bio", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DiffLine{
+		{Equal, "<p>a</p>\n"},
+		{Delete, "<p>{{ Name }}</p>\n"},
+		{Insert, "<p>B</p>\n"},
+		{Equal, "<p>c</p>\n"},
+		{Insert, "<p>d</p>\n"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got diff %v, want %v", d, want)
+	}
+	b := new(bytes.Buffer)
+	if err := RenderDiff(b, d); err != nil {
+		t.Fatal(err)
+	}
+	wantHTML := "<pre class=\"diff\">&lt;p&gt;a&lt;/p&gt;\n<del>&lt;p&gt;{{ Name }}&lt;/p&gt;\n</del>" +
+		"<ins>&lt;p&gt;B&lt;/p&gt;\n</ins>&lt;p&gt;c&lt;/p&gt;\n<ins>&lt;p&gt;d&lt;/p&gt;\n</ins></pre>"
+	if got := b.String(); got != wantHTML {
+		t.Errorf("got HTML\n%s\nwant\n%s", got, wantHTML)
+	}
+}
@@ -0,0 +1,284 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Drafter is a Store that also holds drafts: changes that have been saved
+// but not yet published. Get returns the published document, and GetDraft the
+// latest one, so that editors can preview their changes.
+type Drafter interface {
+	Store
+	GetDraft(ctx context.Context, id string) (io.ReadCloser, error)
+}
+
+// State is the state of a revision in a Versioned store.
+type State int
+
+const (
+	// Draft revisions are newer than the published revision.
+	Draft State = iota
+	// Published is the state of the revision that Get returns.
+	Published
+	// Archived revisions are older than the published revision.
+	Archived
+)
+
+func (s State) String() string {
+	switch s {
+	case Draft:
+		return "draft"
+	case Published:
+		return "published"
+	case Archived:
+		return "archived"
+	}
+	return "unknown"
+}
+
+// Revision describes one revision of a document.
+type Revision struct {
+	// Rev numbers the revisions of a document from 1.
+	Rev     int
+	State   State
+	Created time.Time
+}
+
+// Versioned is a Store that keeps every revision of its documents in memory.
+// Revisions are immutable: Put saves a new draft revision, Publish makes a
+// revision the one that Get returns, and Rollback publishes a copy of an
+// earlier revision as a new one, so that history is never rewritten.
+//
+// Get and List see only published documents. A document that has drafts but
+// has never been published is not found by Get.
+type Versioned struct {
+	mu   sync.RWMutex
+	docs map[string]*history
+	now  func() time.Time // for tests
+}
+
+type history struct {
+	revs      [][]byte
+	created   []time.Time
+	published int // 0 if none
+}
+
+// NewVersioned returns an empty Versioned store.
+func NewVersioned() *Versioned {
+	return &Versioned{docs: map[string]*history{}, now: time.Now}
+}
+
+// Get opens the published revision of the document.
+func (v *Versioned) Get(ctx context.Context, id string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	h, ok := v.docs[id]
+	if !ok || h.published == 0 {
+		return nil, &NotFoundError{ID: id}
+	}
+	return open(h.revs[h.published-1]), nil
+}
+
+// GetDraft opens the latest revision of the document, published or not.
+func (v *Versioned) GetDraft(ctx context.Context, id string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	h, ok := v.docs[id]
+	if !ok {
+		return nil, &NotFoundError{ID: id}
+	}
+	return open(h.revs[len(h.revs)-1]), nil
+}
+
+// GetRevision opens the given revision of the document.
+func (v *Versioned) GetRevision(ctx context.Context, id string, rev int) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	b, err := v.revision(id, rev)
+	if err != nil {
+		return nil, err
+	}
+	return open(b), nil
+}
+
+// revision returns the content of a revision. v.mu must be held.
+func (v *Versioned) revision(id string, rev int) ([]byte, error) {
+	h, ok := v.docs[id]
+	if !ok {
+		return nil, &NotFoundError{ID: id}
+	}
+	if rev < 1 || rev > len(h.revs) {
+		return nil, &NotFoundError{ID: id, Rev: rev}
+	}
+	return h.revs[rev-1], nil
+}
+
+func open(b []byte) io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(b))
+}
+
+// Revisions lists the revisions of the document, oldest first.
+func (v *Versioned) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	h, ok := v.docs[id]
+	if !ok {
+		return nil, &NotFoundError{ID: id}
+	}
+	revs := make([]Revision, len(h.revs))
+	for i := range h.revs {
+		r := Revision{Rev: i + 1, Created: h.created[i]}
+		switch {
+		case r.Rev == h.published:
+			r.State = Published
+		case r.Rev > h.published:
+			r.State = Draft
+		default:
+			r.State = Archived
+		}
+		revs[i] = r
+	}
+	return revs, nil
+}
+
+// List returns the IDs of the documents that have a published revision.
+func (v *Versioned) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	var ids []string
+	for id, h := range v.docs {
+		if h.published != 0 {
+			ids = append(ids, id)
+		}
+	}
+	v.mu.RUnlock()
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Put saves a new draft revision of the document.
+func (v *Versioned) Put(ctx context.Context, id string, r io.Reader) error {
+	_, err := v.Save(ctx, id, r)
+	return err
+}
+
+// Save is like Put, but returns the number of the new revision.
+func (v *Versioned) Save(ctx context.Context, id string, r io.Reader) (int, error) {
+	if err := checkID(id); err != nil {
+		return 0, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.save(id, b), nil
+}
+
+// save appends a revision. v.mu must be held.
+func (v *Versioned) save(id string, b []byte) int {
+	if v.docs == nil {
+		v.docs = map[string]*history{}
+	}
+	h, ok := v.docs[id]
+	if !ok {
+		h = &history{}
+		v.docs[id] = h
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	h.revs = append(h.revs, b)
+	h.created = append(h.created, now())
+	return len(h.revs)
+}
+
+// Publish makes the given revision of the document the one that Get returns.
+// Publishing an older revision moves the newer ones back to drafts; use
+// Rollback to return to an older revision without doing that.
+func (v *Versioned) Publish(ctx context.Context, id string, rev int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, err := v.revision(id, rev); err != nil {
+		return err
+	}
+	v.docs[id].published = rev
+	return nil
+}
+
+// Rollback publishes a copy of the given revision of the document as a new
+// revision, which it returns.
+func (v *Versioned) Rollback(ctx context.Context, id string, rev int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	b, err := v.revision(id, rev)
+	if err != nil {
+		return 0, err
+	}
+	n := v.save(id, b)
+	v.docs[id].published = n
+	return n, nil
+}
+
+// Delete removes the document and all its revisions.
+func (v *Versioned) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.docs[id]; !ok {
+		return &NotFoundError{ID: id}
+	}
+	delete(v.docs, id)
+	return nil
+}
+
+// Diff compares two revisions of the document line by line.
+func (v *Versioned) Diff(ctx context.Context, id string, from, to int) ([]DiffLine, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v.mu.RLock()
+	a, err := v.revision(id, from)
+	var b []byte
+	if err == nil {
+		b, err = v.revision(id, to)
+	}
+	v.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return Diff(string(a), string(b)), nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+)
+
+// A Watcher is a Store that can report which of its documents have changed.
+// It lets the owners of caches built from the documents, such as the parsed
+// templates of an nml.Registry, pick up edits without a restart.
+type Watcher interface {
+	Store
+	// Changed returns the IDs of the documents that were created,
+	// modified or removed since the previous call. The first call
+	// returns nothing and records the current state.
+	Changed(ctx context.Context) ([]string, error)
+}
+
+// Changed polls the modification times of the files under Root. Each call
+// walks the whole tree, which is fine for the few hundred files of a site in
+// development but is not meant for production.
+func (s *FS) Changed(ctx context.Context) ([]string, error) {
+	stamps, err := s.stamps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.seen
+	s.seen = stamps
+	if old == nil {
+		return nil, nil
+	}
+	var changed []string
+	for id, t := range stamps {
+		if o, ok := old[id]; !ok || o.name != t.name || !o.mod.Equal(t.mod) {
+			changed = append(changed, id)
+		}
+	}
+	for id := range old {
+		if _, ok := stamps[id]; !ok {
+			changed = append(changed, id)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// A stamp identifies a version of a document: the file Get would open, and
+// its modification time.
+type stamp struct {
+	name string
+	mod  time.Time
+}
+
+// stamps returns the stamp of each document.
+func (s *FS) stamps(ctx context.Context) (map[string]stamp, error) {
+	ids, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stamps := make(map[string]stamp, len(ids))
+	for _, id := range ids {
+		name, err := s.find(id)
+		if err != nil {
+			continue // removed since List
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		stamps[id] = stamp{name, fi.ModTime()}
+	}
+	return stamps, nil
+}
+
+// Load copies every document of s into a new Memory, so that serving no
+// longer touches s. It fails on the first document that cannot be read.
+func Load(ctx context.Context, s Store) (*Memory, error) {
+	ids, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := NewMemory(nil)
+	for _, id := range ids {
+		r, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		err = m.Put(ctx, id, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -1,20 +1,31 @@
-// First we run PreParse on each element, starting from the deepest. If we need to
-// alter the contents, we should do it here
-// We run PreRender on each element, starting from the root.
+// Package tags holds the custom elements of the site. We run Init on each
+// element, starting from the deepest, so by the time a component's Init runs
+// its children are ready. If we need to alter the contents, we should do it
+// here. We run PreRender on each element, starting from the root.
 package tags
 
 import (
+	"context"
+	"io"
 	"nml"
+	"store"
 )
 
-func Index(node *nml.NodeStruct) nml.Node {
-	switch node.GetData() {
-	case "my-tag":
-		return &MyTag{NodeStruct: node}
-	case "my-bio":
-		return &MyBio{NodeStruct: node}
-	}
+// Registry holds every custom element on the site. Each component registers
+// itself from an init function in its own file.
+var Registry = nml.NewRegistry(func(node *nml.NodeStruct) nml.Node {
 	return &Tag{NodeStruct: node}
+})
+
+func init() {
+	Registry.Templates = func(id string) (io.Reader, error) {
+		return store.Active().Get(context.Background(), id)
+	}
+}
+
+// Index is the lookup function for the site's documents.
+func Index(node *nml.NodeStruct) nml.Node {
+	return Registry.Lookup(node)
 }
 
 type Tag struct {
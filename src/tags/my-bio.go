@@ -2,24 +2,25 @@ package tags
 
 import (
 	"nml"
-	"store"
-	"goquery"
-	"fmt"
 )
 
+func init() {
+	Registry.Register("my-bio", func(node *nml.NodeStruct) nml.Node {
+		return &MyBio{NodeStruct: node}
+	})
+}
+
 type MyBio struct {
 	*nml.NodeStruct
-	Color string
+	Color string `attr:"color"`
 }
 
-func (n *MyBio) Init() error {
-	reader := store.Get("bio")
-	children, err := nml.ParseFragmentBody(reader, Index); if err != nil { return err }
-	nml.AppendChildren(n, children)
-	return nil
+func (n *MyBio) Template() string {
+	return "bio"
 }
 
-func (n *MyBio) Render() {
-	g := goquery.NewDocumentFromNode(n)
-	g.Selection.SetAttr("style", fmt.Sprint("color:", n.Color, ";"))
+// Category lets <my-bio> be written as <my-bio id="Me"/>, since its content
+// all comes from its template.
+func (n *MyBio) Category() nml.Category {
+	return nml.SelfClosing
 }
@@ -0,0 +1,27 @@
+package tags
+
+import (
+	"nml"
+)
+
+func init() {
+	Registry.Register("my-card", func(node *nml.NodeStruct) nml.Node {
+		return &MyCard{NodeStruct: node}
+	})
+}
+
+// MyCard lays out its content in a card with a title. The title comes from
+// the child with slot="title", and everything else goes into the body.
+type MyCard struct {
+	*nml.NodeStruct
+}
+
+func (n *MyCard) Template() string {
+	return "card"
+}
+
+// Category makes <my-card> a block, so that it can be used inside a <p> and
+// hold paragraphs of its own.
+func (n *MyCard) Category() nml.Category {
+	return nml.Block
+}
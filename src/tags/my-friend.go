@@ -0,0 +1,41 @@
+package tags
+
+import (
+	"cache"
+	"nml"
+	"time"
+)
+
+func init() {
+	Registry.Register("my-friend", func(node *nml.NodeStruct) nml.Node {
+		return &MyFriend{NodeStruct: node}
+	})
+}
+
+// Friends are the people that have a page.
+var Friends = []string{"Alice", "Bob"}
+
+// MyFriend wraps the page of the friend named in the URL, which is a 404 for
+// anyone else.
+type MyFriend struct {
+	*nml.NodeStruct
+	Name string
+}
+
+func (n *MyFriend) Init() error {
+	name, err := nml.Eval(n, "Params.name")
+	if err != nil {
+		return err
+	}
+	for _, f := range Friends {
+		if f == name {
+			n.Name = f
+			return nil
+		}
+	}
+	return nml.ErrNotFound
+}
+
+func (n *MyFriend) CachePolicy() cache.Policy {
+	return cache.Policy{TTL: time.Minute}
+}
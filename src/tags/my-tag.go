@@ -1,28 +1,38 @@
 package tags
 
 import (
+	"cache"
 	"nml"
-	"goquery"
-	"errors"
+	"time"
 )
 
+func init() {
+	Registry.Register("my-tag", func(node *nml.NodeStruct) nml.Node {
+		return &MyTag{NodeStruct: node}
+	})
+}
+
 type MyTag struct {
 	*nml.NodeStruct
-	Me *MyBio
+	Me *MyBio `nml:"#Me"`
+	Friends []string
 }
 
 func (n *MyTag) Init() error {
-	err := n.NodeStruct.Init(); if err != nil { return err }
-	g := goquery.NewDocumentFromNode(n)
-	me, ok := g.Selection.Find("#Me").Nodes[0].(*MyBio); if !ok { return errors.New("#Me is not a MyBio") }
-	n.Me = me
 	n.Me.Color = "foo"
-	n.Logger.Info("%#v", n.Me)
+	n.Friends = Friends
+	n.Logger.Debug("init", "color", n.Me.Color, "friends", len(n.Friends))
 	return nil
 }
 
-func (n *MyTag) Render() {
-	n.Logger.Info("%#v", n.Me)
+func (n *MyTag) PreRender() error {
+	n.Logger.Debug("pre-render", "color", n.Me.Color)
 	me := n.Me
 	me.Color = "red"
+	return nil
+}
+
+// The home page changes rarely, so it can be cached for a while.
+func (n *MyTag) CachePolicy() cache.Policy {
+	return cache.Policy{TTL: 5 * time.Minute}
 }